@@ -14,6 +14,18 @@ locals {
   env_vars = include.env.locals
 }
 
+# Juju controller VMs composed and deployed by maas-compose-vms
+dependency "maas_compose_vms" {
+  config_path = "../maas-compose-vms"
+
+  mock_outputs = {
+    vm_ip_addresses = {}
+    vms_by_tag      = {}
+  }
+
+  skip_outputs = true
+}
+
 # Note: This unit is not currently active
 
 inputs = {
@@ -22,6 +34,9 @@ inputs = {
   # lxd_address      = "https://10.0.0.1:8443"
   # lxd_project      = "maas-charms"
   # lxd_trust_token  = "<your-lxd-trust-token>"
+  #
+  # Juju controller VMs composed by maas-compose-vms, with their FQDNs and addresses:
+  # [for vm in dependency.maas_compose_vms.outputs.vms_by_tag["juju-controller"] : vm.ip_addresses["eth0"]]
 }
 
 # This module outputs:
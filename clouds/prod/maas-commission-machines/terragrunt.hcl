@@ -0,0 +1,66 @@
+# MAAS Commission Machines Unit - Run commissioning and hardware tests on enlisted machines
+terraform {
+  # The double slash copies all modules so the readiness gate module is available
+  source = "../../../modules//maas-commission-machines"
+
+  extra_arguments "common_vars" {
+    commands = get_terraform_commands_that_need_vars()
+
+    optional_var_files = [
+      "${get_terragrunt_dir()}/commissioning.tfvars"
+    ]
+  }
+}
+
+# Dependencies - this module depends on maas-setup (for API credentials)
+dependency "maas_setup" {
+  config_path = "../maas-setup"
+
+  mock_outputs = {
+    maas_api_url = "http://mock-maas-api:5240/MAAS"
+    maas_api_key = "mock-api-key:mock-token:mock-secret"
+  }
+
+  # Skip outputs if the dependency hasn't been applied yet
+  skip_outputs = true
+}
+
+# Machines must be enlisted before they can be commissioned
+dependency "machines" {
+  config_path = "../maas-enlist-machines"
+
+  mock_outputs = {
+    machine_ids = {
+      "compute-01" = "mock-machine-id-1"
+    }
+  }
+
+  skip_outputs = true
+}
+
+# Generate provider configuration (the module's provider.tf only pins versions)
+generate "provider" {
+  path      = "maas_provider.tf"
+  if_exists = "overwrite_terragrunt"
+  contents  = <<EOF
+provider "maas" {
+  api_version = "2.0"
+  api_key     = var.maas_api_key
+  api_url     = var.maas_api_url
+}
+EOF
+}
+
+inputs = {
+  # MAAS API credentials from maas-setup module
+  maas_api_url = dependency.maas_setup.outputs.maas_api_url
+  maas_api_key = dependency.maas_setup.outputs.maas_api_key
+
+  # Commissioning/testing scripts uploaded to MAAS
+  scripts_dir = "${get_terragrunt_dir()}/scripts"
+
+  # Readiness gate: wait for enlistment commissioning to finish
+  wait_for_state = "Ready"
+
+  # machines and tag_scripts will be loaded from commissioning.tfvars
+}
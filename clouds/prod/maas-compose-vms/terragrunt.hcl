@@ -1,6 +1,8 @@
 # MAAS Compose VMs Unit - Compose virtual machines on VM hosts
 terraform {
-  source = "../../../modules/maas-compose-vms"
+  # The double slash copies all modules so the readiness gate, node networking
+  # and node storage modules used after composition are available
+  source = "../../../modules//maas-compose-vms"
 
   extra_arguments "common_vars" {
     commands = get_terraform_commands_that_need_vars()
@@ -25,9 +27,36 @@ dependency "maas_setup" {
   skip_outputs = true
 }
 
-# Generate provider configuration
+# Zones, resource pools and tags referenced by VMs are created by maas-config
+dependency "maas_config" {
+  config_path = "../maas-config"
+
+  mock_outputs = {
+    zones          = {}
+    resource_pools = {}
+    tags           = {}
+  }
+
+  # Mocks are only used until maas-config is applied
+  mock_outputs_allowed_terraform_commands = ["init", "validate", "plan"]
+}
+
+# VM hosts VMs are composed on are registered by maas-vm-hosts; the module
+# reads their zones from MAAS
+dependency "maas_vm_hosts" {
+  config_path = "../maas-vm-hosts"
+
+  mock_outputs = {
+    vm_hosts = {}
+  }
+
+  # Mocks are only used until maas-vm-hosts is applied
+  mock_outputs_allowed_terraform_commands = ["init", "validate", "plan"]
+}
+
+# Generate provider configuration (the module declares maas_api_url and maas_api_key)
 generate "provider" {
-  path      = "provider.tf"
+  path      = "maas_provider.tf"
   if_exists = "overwrite_terragrunt"
   contents  = <<EOF
 provider "maas" {
@@ -35,18 +64,6 @@ provider "maas" {
   api_key     = var.maas_api_key
   api_url     = var.maas_api_url
 }
-
-variable "maas_api_url" {
-  description = "MAAS API URL"
-  type        = string
-  sensitive   = true
-}
-
-variable "maas_api_key" {
-  description = "MAAS API Key"
-  type        = string
-  sensitive   = true
-}
 EOF
 }
 
@@ -54,4 +71,7 @@ EOF
 inputs = {
   maas_api_url = dependency.maas_setup.outputs.maas_api_url
   maas_api_key = dependency.maas_setup.outputs.maas_api_key
+
+  # Tags created by maas-config, which VMs are added to rather than owned here
+  managed_tags = keys(dependency.maas_config.outputs.tags)
 }
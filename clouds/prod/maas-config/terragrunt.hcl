@@ -1,24 +1,30 @@
-# MAAS Configuration - Configure MAAS resources using Canonical's maas-config module
+# MAAS Configuration Unit - Zones, resource pools, tags, DNS domains and global settings
 include "env" {
   path   = find_in_parent_folders("env.hcl")
   expose = true
 }
 
 terraform {
-  # Using Canonical's maas-terraform-modules from GitHub
-  # Reference: https://github.com/canonical/maas-terraform-modules/tree/main/modules/maas-config
-  source = "git::https://github.com/canonical/maas-terraform-modules.git//modules/maas-config?ref=main"
+  source = "../../../modules/maas-config"
+
+  extra_arguments "common_vars" {
+    commands = get_terraform_commands_that_need_vars()
+
+    optional_var_files = [
+      "${get_terragrunt_dir()}/config.tfvars"
+    ]
+  }
 }
 
 # Dependencies - this module depends on maas-setup
 dependency "maas_setup" {
   config_path = "../maas-setup"
-  
+
   mock_outputs = {
     maas_api_url = "http://mock-maas-api:5240/MAAS"
-    maas_api_key = "mock-api-key"
+    maas_api_key = "mock-api-key:mock-token:mock-secret"
   }
-  
+
   # Skip outputs if the dependency hasn't been applied yet
   skip_outputs = true
 }
@@ -27,23 +33,23 @@ locals {
   env_vars = include.env.locals
 }
 
-# Note: This unit is not currently active
+# Generate provider configuration (the module's provider.tf only pins versions)
+generate "provider" {
+  path      = "maas_provider.tf"
+  if_exists = "overwrite_terragrunt"
+  contents  = <<EOF
+provider "maas" {
+  api_version = "2.0"
+  api_key     = var.maas_api_key
+  api_url     = var.maas_api_url
+}
+EOF
+}
 
 inputs = {
-  # Example inputs for when you're ready to configure MAAS:
-  # Use outputs from maas-setup module
-  # maas_url = dependency.maas_setup.outputs.maas_api_url
-  # maas_key = dependency.maas_setup.outputs.maas_api_key
-  
-  # Boot image configuration
-  # boot_selections = {
-  #   "jammy" = {
-  #     arches = ["amd64"]
-  #   }
-  # }
-  
-  # Additional MAAS configuration
-  # maas_config = {}
-  # domains = {}
-  # tags = {}
+  # MAAS API credentials from maas-setup module
+  maas_api_url = dependency.maas_setup.outputs.maas_api_url
+  maas_api_key = dependency.maas_setup.outputs.maas_api_key
+
+  # zones, resource_pools, tags, domains and maas_settings will be loaded from config.tfvars
 }
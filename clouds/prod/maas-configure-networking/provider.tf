@@ -4,6 +4,10 @@ terraform {
       source  = "canonical/maas"
       version = "~> 2.6.0"
     }
+    null = {
+      source  = "hashicorp/null"
+      version = "~> 3.2"
+    }
   }
 }
 
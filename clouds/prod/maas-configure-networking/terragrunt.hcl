@@ -34,9 +34,14 @@ generate "main" {
 module "maas_configure_networking" {
   source = "${get_terragrunt_dir()}/../../../modules/maas-configure-networking"
 
+  # MAAS API credentials for the CLI calls that set space descriptions
+  maas_api_url = var.maas_api_url
+  maas_api_key = var.maas_api_key
+
   # Pass variables from tfvars
-  spaces  = var.spaces
-  fabrics = var.fabrics
+  spaces        = var.spaces
+  fabrics       = var.fabrics
+  static_routes = var.static_routes
 }
 
 # Outputs
@@ -56,9 +61,29 @@ output "subnets" {
   value = module.maas_configure_networking.subnets
 }
 
+output "subnets_by_name" {
+  value = module.maas_configure_networking.subnets_by_name
+}
+
+output "subnet_ids" {
+  value = module.maas_configure_networking.subnet_ids
+}
+
 output "ip_ranges" {
   value = module.maas_configure_networking.ip_ranges
 }
+
+output "ip_ranges_by_subnet" {
+  value = module.maas_configure_networking.ip_ranges_by_subnet
+}
+
+output "vlan_dhcp" {
+  value = module.maas_configure_networking.vlan_dhcp
+}
+
+output "static_routes" {
+  value = module.maas_configure_networking.static_routes
+}
 EOT
 }
 
@@ -73,6 +98,10 @@ terraform {
       source  = "canonical/maas"
       version = "~> 2.6.0"
     }
+    null = {
+      source  = "hashicorp/null"
+      version = "~> 3.2"
+    }
   }
 }
 
@@ -30,15 +30,25 @@ variable "spaces" {
 variable "fabrics" {
   description = "Map of fabrics with nested VLANs and subnets"
   type = map(object({
-    vlans = list(object({
-      vid     = number
-      space   = optional(string)
-      dhcp_on = optional(bool)
-      mtu     = optional(number)
+    vlans = map(object({
+      vid            = optional(number)
+      space          = optional(string)
+      dhcp_on        = optional(bool)
+      mtu            = optional(number)
+      relay_vlan     = optional(string)
+      primary_rack   = optional(string)
+      secondary_rack = optional(string)
       subnets = map(object({
-        cidr        = string
-        gateway_ip  = optional(string)
-        dns_servers = optional(list(string))
+        cidr                        = string
+        gateway_ip                  = optional(string)
+        dns_servers                 = optional(list(string))
+        allow_dns                   = optional(bool, true)
+        allow_proxy                 = optional(bool, true)
+        rdns_mode                   = optional(number, 2)
+        managed                     = optional(bool, true)
+        active_discovery            = optional(bool, false)
+        disabled_boot_architectures = optional(list(string), [])
+        ipv6_mode                   = optional(string)
         reserved = optional(map(object({
           start_ip = string
           end_ip   = string
@@ -49,3 +59,14 @@ variable "fabrics" {
   }))
   default = {}
 }
+
+variable "static_routes" {
+  description = "Map of static routes between subnets, keyed by route name"
+  type = map(object({
+    source      = string
+    destination = string
+    gateway_ip  = string
+    metric      = optional(number, 0)
+  }))
+  default = {}
+}
@@ -1,5 +1,6 @@
 terraform {
-  source = "../../../modules/maas-configure-nodes-storage"
+  # The double slash copies all modules so the readiness gate module is available
+  source = "../../../modules//maas-configure-nodes-storage"
 
   extra_arguments "common_vars" {
     commands = get_terraform_commands_that_need_vars()
@@ -24,3 +25,8 @@ dependency "node_config" {
 
   skip_outputs = true
 }
+
+inputs = {
+  # Readiness gate: machines must be Ready before their storage is configured
+  wait_for_state = "Ready"
+}
@@ -1,5 +1,6 @@
 terraform {
-  source = "../../../modules/maas-configure-nodes-networking"
+  # The double slash copies all modules so the readiness gate module is available
+  source = "../../../modules//maas-configure-nodes-networking"
 
   extra_arguments "common_vars" {
     commands = get_terraform_commands_that_need_vars()
@@ -32,17 +33,36 @@ dependency "networking" {
   
   mock_outputs = {
     subnet_ids = {
-      "mgmt"    = "mock-subnet-mgmt"
-      "data"    = "mock-subnet-data"
-      "storage" = "mock-subnet-storage"
+      "oam"         = "mock-subnet-oam"
+      "internal"    = "mock-subnet-internal"
+      "ceph_access" = "mock-subnet-ceph-access"
     }
   }
-  
-  skip_outputs = true
+
+  # Subnet names resolve to real IDs once networking is applied
+  mock_outputs_allowed_terraform_commands = ["init", "validate", "plan"]
+}
+
+# Generate provider configuration (the module's provider.tf only declares the credentials)
+generate "provider" {
+  path      = "maas_provider.tf"
+  if_exists = "overwrite_terragrunt"
+  contents  = <<EOF
+provider "maas" {
+  api_url = var.maas_api_url
+  api_key = var.maas_api_key
+}
+EOF
 }
 
 # Pass MAAS credentials to module
 inputs = {
   maas_api_url = get_env("TF_VAR_maas_api_url", "")
   maas_api_key = get_env("TF_VAR_maas_api_key", "")
+
+  # Readiness gate: machines must be Ready before their networking is configured
+  wait_for_state = "Ready"
+
+  # Subnet names (e.g. "oam") usable as subnet_id in network_profiles and nodes
+  subnet_ids = dependency.networking.outputs.subnet_ids
 }
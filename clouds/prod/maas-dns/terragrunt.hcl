@@ -0,0 +1,95 @@
+# MAAS DNS Unit - Manage MAAS DNS domains and records
+include "env" {
+  path   = find_in_parent_folders("env.hcl")
+  expose = true
+}
+
+terraform {
+  source = "../../../modules/maas-dns"
+
+  extra_arguments "common_vars" {
+    commands = get_terraform_commands_that_need_vars()
+
+    optional_var_files = [
+      "${get_terragrunt_dir()}/dns.tfvars"
+    ]
+  }
+}
+
+# Dependencies - this module depends on maas-setup
+dependency "maas_setup" {
+  config_path = "../maas-setup"
+
+  mock_outputs = {
+    maas_api_url = "http://mock-maas-api:5240/MAAS"
+    maas_api_key = "mock-api-key:mock-token:mock-secret"
+  }
+
+  # Skip outputs if the dependency hasn't been applied yet
+  skip_outputs = true
+}
+
+# DNS domains are created by maas-config
+dependency "maas_config" {
+  config_path = "../maas-config"
+
+  mock_outputs = {
+    domains = {}
+  }
+
+  mock_outputs_allowed_terraform_commands = ["init", "validate", "plan"]
+}
+
+# Reserved ranges (e.g. metallb) for range_records
+dependency "networking" {
+  config_path = "../maas-configure-networking"
+
+  mock_outputs = {
+    ip_ranges_by_subnet = {}
+  }
+
+  mock_outputs_allowed_terraform_commands = ["init", "validate", "plan"]
+}
+
+# Node static IPs for node_records
+dependency "nodes" {
+  config_path = "../maas-configure-nodes"
+
+  mock_outputs = {
+    static_ip_addresses = {}
+  }
+
+  mock_outputs_allowed_terraform_commands = ["init", "validate", "plan"]
+}
+
+locals {
+  env_vars = include.env.locals
+}
+
+# Generate provider configuration (the module's provider.tf only pins versions)
+generate "provider" {
+  path      = "maas_provider.tf"
+  if_exists = "overwrite_terragrunt"
+  contents  = <<EOF
+provider "maas" {
+  api_version = "2.0"
+  api_key     = var.maas_api_key
+  api_url     = var.maas_api_url
+}
+EOF
+}
+
+inputs = {
+  # MAAS API credentials from maas-setup module
+  maas_api_url = dependency.maas_setup.outputs.maas_api_url
+  maas_api_key = dependency.maas_setup.outputs.maas_api_key
+
+  # Domains the records can use
+  domains = dependency.maas_config.outputs.domains
+
+  # Derived record sources
+  ip_ranges_by_subnet      = dependency.networking.outputs.ip_ranges_by_subnet
+  node_static_ip_addresses = dependency.nodes.outputs.static_ip_addresses
+
+  # records, node_records and range_records will be loaded from dns.tfvars
+}
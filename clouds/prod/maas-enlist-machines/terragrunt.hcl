@@ -1,6 +1,6 @@
 # MAAS Enlist Machines Unit - Enlist multiple machines
 terraform {
-  source = "."
+  source = "../../../modules/maas-enlist-machines"
 
   extra_arguments "common_vars" {
     commands = get_terraform_commands_that_need_vars()
@@ -25,11 +25,14 @@ dependency "maas_setup" {
   skip_outputs = true
 }
 
+# Zones, resource pools and tags referenced by machines are created by maas-config
 dependency "maas_config" {
   config_path = "../maas-config"
-  
+
   mock_outputs = {
-    maas_configured = true
+    zones          = {}
+    resource_pools = {}
+    tags           = {}
   }
   
   # Skip outputs if the dependency hasn't been applied yet
@@ -52,48 +55,39 @@ dependency "maas_configure_networking" {
 }
 
 locals {
-  # Machines will be loaded from tfvars file, not from locals
-  # This is just a placeholder for the generate block
-  machines = {}
+  # Named BMC credentials, kept out of machines.tfvars
+  # Sources (later ones win): bmc-credentials.json in this directory, then the
+  # BMC_CREDENTIALS_JSON environment variable (e.g. exported from a secret store)
+  bmc_credentials_file = "${get_terragrunt_dir()}/bmc-credentials.json"
+  bmc_credentials = merge(
+    fileexists(local.bmc_credentials_file) ? jsondecode(file(local.bmc_credentials_file)) : {},
+    jsondecode(get_env("BMC_CREDENTIALS_JSON", "{}"))
+  )
 }
 
 # Note: Remove or comment out the skip line below when ready to enlist machines
 # skip = true
 
-# Generate main.tf with dynamic machine module calls
-generate "main" {
-  path      = "main.tf"
-  if_exists = "overwrite"
-  contents  = <<-EOT
-# MAAS Machines - Dynamically enlist machines based on the machines variable
-
-module "machine" {
-  for_each = var.machines
-  source   = "${get_terragrunt_dir()}/../../../modules/maas-enlist-machines"
-
-  power_type = each.value.power_type
-  power_parameters = jsonencode({
-    power_address   = each.value.power_address
-    power_user      = try(each.value.power_user, null)
-    power_pass      = try(each.value.power_pass, null)
-    power_driver    = try(each.value.power_driver, null)
-    power_boot_type = try(each.value.power_boot_type, null)
-    cipher_suite_id = try(each.value.cipher_suite_id, null)
-  })
-
-  pxe_mac_address = each.value.pxe_mac_address
-  hostname        = each.key
-  zone            = try(each.value.zone, null)
-  architecture    = try(each.value.architecture, "amd64/generic")
+# Generate provider configuration (the module's provider.tf only pins versions)
+generate "provider" {
+  path      = "maas_provider.tf"
+  if_exists = "overwrite_terragrunt"
+  contents  = <<EOF
+provider "maas" {
+  api_version = "2.0"
+  api_key     = var.maas_api_key
+  api_url     = var.maas_api_url
 }
-  EOT
+EOF
 }
 
 inputs = {
   # MAAS API credentials from maas-setup module
-  maas_api_url     = dependency.maas_setup.outputs.maas_api_url
-  maas_api_key     = dependency.maas_setup.outputs.maas_api_key
-  maas_api_version = "2.0"
+  maas_api_url = dependency.maas_setup.outputs.maas_api_url
+  maas_api_key = dependency.maas_setup.outputs.maas_api_key
+
+  # BMC credentials from bmc-credentials.json / BMC_CREDENTIALS_JSON
+  bmc_credentials = local.bmc_credentials
   
   # Machines variable will be loaded from tfvars file
 }
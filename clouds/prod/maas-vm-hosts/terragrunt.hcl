@@ -0,0 +1,80 @@
+# MAAS VM Hosts Unit - Register LXD and virsh VM hosts with MAAS
+include "env" {
+  path   = find_in_parent_folders("env.hcl")
+  expose = true
+}
+
+terraform {
+  source = "../../../modules/maas-vm-hosts"
+
+  extra_arguments "common_vars" {
+    commands = get_terraform_commands_that_need_vars()
+
+    optional_var_files = [
+      "${get_terragrunt_dir()}/vm-hosts.tfvars"
+    ]
+  }
+}
+
+# Dependencies - this module depends on maas-setup
+dependency "maas_setup" {
+  config_path = "../maas-setup"
+
+  mock_outputs = {
+    maas_api_url = "http://mock-maas-api:5240/MAAS"
+    maas_api_key = "mock-api-key:mock-token:mock-secret"
+  }
+
+  # Skip outputs if the dependency hasn't been applied yet
+  skip_outputs = true
+}
+
+# Zones, resource pools and tags assigned to VM hosts are created by maas-config
+dependency "maas_config" {
+  config_path = "../maas-config"
+
+  mock_outputs = {
+    zones          = {}
+    resource_pools = {}
+    tags           = {}
+  }
+
+  skip_outputs = true
+}
+
+locals {
+  env_vars = include.env.locals
+
+  # LXD trust passwords, client certificates and virsh passwords, kept out of vm-hosts.tfvars
+  # Sources (later ones win): vm-host-credentials.json in this directory, then the
+  # VM_HOST_CREDENTIALS_JSON environment variable (e.g. exported from a secret store)
+  vm_host_credentials_file = "${get_terragrunt_dir()}/vm-host-credentials.json"
+  vm_host_credentials = merge(
+    fileexists(local.vm_host_credentials_file) ? jsondecode(file(local.vm_host_credentials_file)) : {},
+    jsondecode(get_env("VM_HOST_CREDENTIALS_JSON", "{}"))
+  )
+}
+
+# Generate provider configuration (the module's provider.tf only pins versions)
+generate "provider" {
+  path      = "maas_provider.tf"
+  if_exists = "overwrite_terragrunt"
+  contents  = <<EOF
+provider "maas" {
+  api_version = "2.0"
+  api_key     = var.maas_api_key
+  api_url     = var.maas_api_url
+}
+EOF
+}
+
+inputs = {
+  # MAAS API credentials from maas-setup module
+  maas_api_url = dependency.maas_setup.outputs.maas_api_url
+  maas_api_key = dependency.maas_setup.outputs.maas_api_key
+
+  # Credentials from vm-host-credentials.json / VM_HOST_CREDENTIALS_JSON
+  vm_host_credentials = local.vm_host_credentials
+
+  # vm_hosts will be loaded from vm-hosts.tfvars
+}
@@ -0,0 +1,50 @@
+#!/bin/bash
+# Commission a MAAS machine with the selected scripts and wait until it is Ready.
+# On failure, maas-wait prints the result of every script that did not pass.
+#
+# Environment:
+#   MAAS_PROFILE, MAAS_API_URL, MAAS_API_KEY  MAAS CLI login
+#   MACHINE_ID, MACHINE_NAME                  Machine to commission
+#   COMMISSIONING_SCRIPTS, TESTING_SCRIPTS    Comma separated script names (optional)
+#   TIMEOUT, POLL_INTERVAL                    Seconds
+#   WAIT_COMMAND                              maas-wait command line
+set -euo pipefail
+
+# Machines are commissioned in parallel, so each run logs in with its own
+# profile rather than overwriting a shared one another run is using
+profile="$MAAS_PROFILE-commission-$MACHINE_ID-$$"
+maas login "$profile" "$MAAS_API_URL" "$MAAS_API_KEY" > /dev/null
+trap 'maas logout "$profile" > /dev/null 2>&1 || true' EXIT
+
+args=()
+if [ -n "${COMMISSIONING_SCRIPTS:-}" ]; then
+  args+=("commissioning_scripts=$COMMISSIONING_SCRIPTS")
+fi
+if [ -n "${TESTING_SCRIPTS:-}" ]; then
+  args+=("testing_scripts=$TESTING_SCRIPTS")
+fi
+
+# MAAS rejects commissioning a machine that is still commissioning or testing,
+# e.g. right after enlistment, so wait until it can be commissioned
+deadline=$((SECONDS + TIMEOUT))
+while true; do
+  status=$(maas "$profile" machine read "$MACHINE_ID" | jq -r '.status_name')
+  case "$status" in
+    "New" | "Ready" | "Failed commissioning" | "Failed testing") break ;;
+  esac
+  if [ "$SECONDS" -ge "$deadline" ]; then
+    echo "$MACHINE_NAME ($MACHINE_ID) is still $status after ${TIMEOUT}s; not commissioning it" >&2
+    exit 1
+  fi
+  echo "Waiting for $MACHINE_NAME ($status) before commissioning"
+  sleep "$POLL_INTERVAL"
+done
+
+echo "Commissioning $MACHINE_NAME ($MACHINE_ID), currently $status"
+maas "$profile" machine commission "$MACHINE_ID" ${args[@]+"${args[@]}"} > /dev/null
+
+# maas-wait reports the failed scripts of every machine that fails
+# shellcheck disable=SC2086 # WAIT_COMMAND is a command line
+$WAIT_COMMAND -state Ready -timeout "${TIMEOUT}s" \
+  -interval "$(((POLL_INTERVAL + 3) / 4))s" -max-interval "${POLL_INTERVAL}s" "$MACHINE_ID"
+echo "$MACHINE_NAME is Ready"
@@ -0,0 +1,89 @@
+# MAAS Commission Machines Module
+# Uploads custom commissioning/testing scripts, commissions machines with the
+# selected scripts and waits until they reach Ready
+
+locals {
+  # Scripts in scripts_dir, keyed by file name without extension
+  script_files = var.scripts_dir != null ? {
+    for file in fileset(var.scripts_dir, "*.{sh,py}") :
+    replace(file, "/\\.(sh|py)$/", "") => "${var.scripts_dir}/${file}"
+  } : {}
+
+  # Scripts per machine: machine-specific scripts plus scripts of every matching tag
+  machine_scripts = {
+    for hostname, machine in var.machines : hostname => {
+      commissioning_scripts = distinct(concat(
+        machine.commissioning_scripts,
+        flatten([for tag, scripts in var.tag_scripts : scripts.commissioning_scripts if contains(machine.tags, tag)])
+      ))
+      testing_scripts = distinct(concat(
+        machine.testing_scripts,
+        flatten([for tag, scripts in var.tag_scripts : scripts.testing_scripts if contains(machine.tags, tag)])
+      ))
+    }
+  }
+}
+
+# Custom commissioning and testing scripts
+# MAAS reads the script name, type and tags from the metadata embedded in each script
+resource "maas_node_script" "script" {
+  for_each = local.script_files
+
+  script = filebase64(each.value)
+}
+
+# Wait until enlistment commissioning has finished before commissioning again
+module "machines_ready" {
+  source = "../maas-wait-for-machines"
+  count  = var.wait_for_state != null ? 1 : 0
+
+  machines     = keys(var.machines)
+  target_state = var.wait_for_state
+  timeout      = var.wait_timeout
+  wait_command = var.wait_command
+}
+
+# Data source to lookup machine system IDs by hostname
+data "maas_machine" "machines" {
+  for_each = var.machines
+  hostname = each.key
+
+  depends_on = [module.machines_ready]
+}
+
+# Commission each machine and wait until it is Ready
+# Re-runs when the machine, its script selection or the content of its custom scripts change
+resource "null_resource" "commission" {
+  for_each = local.machine_scripts
+
+  triggers = {
+    machine_id            = data.maas_machine.machines[each.key].id
+    commissioning_scripts = join(",", each.value.commissioning_scripts)
+    testing_scripts       = join(",", each.value.testing_scripts)
+    scripts_sha256 = sha256(join(",", [
+      for name in concat(each.value.commissioning_scripts, each.value.testing_scripts) :
+      filesha256(local.script_files[name]) if contains(keys(local.script_files), name)
+    ]))
+  }
+
+  provisioner "local-exec" {
+    command     = "${path.module}/commission-and-wait.sh"
+    interpreter = ["bash"]
+
+    environment = {
+      MAAS_PROFILE          = var.maas_profile
+      MAAS_API_URL          = var.maas_api_url
+      MAAS_API_KEY          = var.maas_api_key
+      MACHINE_ID            = data.maas_machine.machines[each.key].id
+      MACHINE_NAME          = each.key
+      COMMISSIONING_SCRIPTS = join(",", each.value.commissioning_scripts)
+      TESTING_SCRIPTS       = join(",", each.value.testing_scripts)
+      TIMEOUT               = var.commissioning_timeout
+      POLL_INTERVAL         = var.poll_interval
+      WAIT_COMMAND          = join(" ", var.wait_command)
+    }
+  }
+
+  # Custom scripts must exist in MAAS before they can be selected
+  depends_on = [maas_node_script.script]
+}
@@ -0,0 +1,17 @@
+# MAAS Commission Machines Module Outputs
+
+output "node_scripts" {
+  description = "Map of uploaded script names to their MAAS script IDs"
+  value       = { for name, script in maas_node_script.script : name => script.id }
+}
+
+output "commissioned_machines" {
+  description = "Map of commissioned machine hostnames to their system IDs and selected scripts"
+  value = {
+    for hostname, commission in null_resource.commission : hostname => {
+      machine_id            = commission.triggers.machine_id
+      commissioning_scripts = local.machine_scripts[hostname].commissioning_scripts
+      testing_scripts       = local.machine_scripts[hostname].testing_scripts
+    }
+  }
+}
@@ -0,0 +1,12 @@
+terraform {
+  required_providers {
+    maas = {
+      source  = "canonical/maas"
+      version = "~> 2.6.0"
+    }
+    null = {
+      source  = "hashicorp/null"
+      version = "~> 3.2"
+    }
+  }
+}
@@ -0,0 +1,94 @@
+# MAAS Commission Machines Module Variables
+
+variable "scripts_dir" {
+  description = "Directory containing commissioning/testing scripts (*.sh, *.py) to upload. Each script's embedded metadata name must match its file name without extension"
+  type        = string
+  default     = null
+}
+
+variable "machines" {
+  description = <<-EOT
+    Map of machines to commission. Key is the machine hostname in MAAS, value includes:
+    - tags: Tags used to select scripts from tag_scripts (optional)
+    - commissioning_scripts: Extra commissioning scripts for this machine (optional)
+    - testing_scripts: Testing scripts for this machine (optional)
+  EOT
+  type = map(object({
+    tags                  = optional(list(string), [])
+    commissioning_scripts = optional(list(string), [])
+    testing_scripts       = optional(list(string), [])
+  }))
+  default = {}
+}
+
+variable "tag_scripts" {
+  description = <<-EOT
+    Map of tags to the scripts run on every machine carrying the tag. Value includes:
+    - commissioning_scripts: Extra commissioning scripts (optional)
+    - testing_scripts: Testing scripts (optional)
+  EOT
+  type = map(object({
+    commissioning_scripts = optional(list(string), [])
+    testing_scripts       = optional(list(string), [])
+  }))
+  default = {}
+}
+
+variable "commissioning_timeout" {
+  description = "Maximum time in seconds to wait for a machine to reach Ready after commissioning starts"
+  type        = number
+  default     = 3600
+
+  validation {
+    condition     = var.commissioning_timeout > 0
+    error_message = "commissioning_timeout must be greater than 0."
+  }
+}
+
+variable "poll_interval" {
+  description = "Maximum interval in seconds between machine status checks; polling starts at a quarter of it and backs off"
+  type        = number
+  default     = 30
+
+  validation {
+    condition     = var.poll_interval > 0
+    error_message = "poll_interval must be greater than 0."
+  }
+}
+
+# Readiness gate: wait for enlistment commissioning to finish before commissioning
+variable "wait_for_state" {
+  description = "State machines must reach before they are commissioned (normally Ready); null disables the gate"
+  type        = string
+  default     = null
+}
+
+variable "wait_timeout" {
+  description = "How long to wait for machines to reach wait_for_state, as a Go duration (e.g. 30m)"
+  type        = string
+  default     = "30m"
+}
+
+variable "wait_command" {
+  description = "Command running the maas-wait tool (see tools/cmd/maas-wait), also used to wait after commissioning"
+  type        = list(string)
+  default     = ["maas-wait"]
+}
+
+# MAAS API credentials for the MAAS CLI used to commission and wait
+variable "maas_api_url" {
+  description = "MAAS API URL"
+  type        = string
+}
+
+variable "maas_api_key" {
+  description = "MAAS API key for authentication"
+  type        = string
+  sensitive   = true
+}
+
+variable "maas_profile" {
+  description = "MAAS CLI profile name to use for local-exec provisioners"
+  type        = string
+  default     = "root"
+}
@@ -5,52 +5,275 @@ terraform {
       source  = "canonical/maas"
       version = "~> 2.6"
     }
+    external = {
+      source  = "hashicorp/external"
+      version = "~> 2.3"
+    }
+    null = {
+      source  = "hashicorp/null"
+      version = "~> 3.2"
+    }
   }
 }
 
 locals {
+  # Hosts of each spread-by-zone configuration, grouped by zone
+  hosts_by_zone = {
+    for vm_key, vm_config in var.vm_configurations : vm_key => {
+      for host in distinct(vm_config.vm_host) : local.vm_host_zones[host] => host...
+    } if vm_config.placement == "spread-by-zone"
+  }
+
+  # Interleave hosts across zones so consecutive instances land in different zones
+  zone_spread_hosts = {
+    for vm_key, zones in local.hosts_by_zone : vm_key => flatten([
+      for round in range(max(0, [for hosts in values(zones) : length(hosts)]...)) : [
+        for zone, hosts in zones : hosts[round] if length(hosts) > round
+      ]
+    ])
+  }
+
+  # VM host of each instance, per placement strategy:
+  # explicit       - vm_host[i], reusing the last entry
+  # round-robin    - cycle through vm_host
+  # spread-by-zone - cycle through zones, then through the hosts of each zone
+  # anti-affinity  - one instance per distinct host (validated in variables.tf)
+  # capacity       - chosen by maas-vm-schedule (data.external.schedule)
+  placed_hosts = {
+    for vm_key, vm_config in var.vm_configurations : vm_key => [
+      for i in range(vm_config.count) : (
+        vm_config.placement == "capacity" ? null :
+        vm_config.placement == "explicit" ? (length(vm_config.vm_host) > i ? vm_config.vm_host[i] : vm_config.vm_host[length(vm_config.vm_host) - 1]) :
+        vm_config.placement == "spread-by-zone" ? local.zone_spread_hosts[vm_key][i % length(local.zone_spread_hosts[vm_key])] :
+        vm_config.placement == "anti-affinity" ? distinct(vm_config.vm_host)[i] :
+        vm_config.vm_host[i % length(vm_config.vm_host)]
+      )
+    ]
+  }
+
+  # Storage disks of each instance: its storage_disk_overrides entry or the
+  # shared storage_disks, with the boot disk first since MAAS boots from the
+  # first composed disk
+  instance_storage_disks = {
+    for vm_key, vm_config in var.vm_configurations : vm_key => [
+      for i in range(vm_config.count) : concat(
+        [for disk in lookup(vm_config.storage_disk_overrides, tostring(i), coalesce(vm_config.storage_disks, [])) : disk if disk.boot],
+        [for disk in lookup(vm_config.storage_disk_overrides, tostring(i), coalesce(vm_config.storage_disks, [])) : disk if !disk.boot]
+      )
+    ]
+  }
+
+  # Every instance as a scheduling request: capacity-placed instances may go to
+  # any of their vm_host entries (any VM host when empty), the others only
+  # consume capacity on the host already chosen for them
+  schedule_requests = flatten([
+    for vm_key, vm_config in var.vm_configurations : [
+      for i in range(vm_config.count) : {
+        key      = "${vm_key}-${i}"
+        hostname = "${coalesce(vm_config.hostname_prefix, vm_key)}-${i}"
+        cores    = vm_config.cores
+        memory   = vm_config.memory
+        disks = [
+          for disk in local.instance_storage_disks[vm_key][i] : {
+            pool           = disk.pool != null ? disk.pool : ""
+            size_gigabytes = disk.size_gigabytes
+          }
+        ]
+        host       = vm_config.placement == "capacity" ? "" : local.placed_hosts[vm_key][i]
+        candidates = vm_config.placement == "capacity" ? vm_config.vm_host : []
+      }
+    ]
+  ])
+  capacity_placement = anytrue([for vm_key, vm_config in var.vm_configurations : vm_config.placement == "capacity"])
+
   # Create a flat list of VM instances based on count
   vm_instances = flatten([
     for vm_key, vm_config in var.vm_configurations : [
       for i in range(vm_config.count) : {
-        # vm_host is an optional list; assign element i when available, otherwise use last element
-        vm_host = vm_config.vm_host != null ? (length(vm_config.vm_host) > i ? vm_config.vm_host[i] : vm_config.vm_host[length(vm_config.vm_host) - 1]) : null
+        config_key = vm_key
+        vm_host    = vm_config.placement == "capacity" ? local.scheduled_hosts["${vm_key}-${i}"] : local.placed_hosts[vm_key][i]
+        placement  = vm_config.placement
         # Use per-VM zone (list) and pool
         # zone is an optional list; assign element i when available, otherwise use last element
-        zone = vm_config.zone != null ? (length(vm_config.zone) > i ? vm_config.zone[i] : vm_config.zone[length(vm_config.zone) - 1]) : null
+        # spread-by-zone VMs default to the zone of their VM host
+        zone = vm_config.zone != null ? (length(vm_config.zone) > i ? vm_config.zone[i] : vm_config.zone[length(vm_config.zone) - 1]) : (
+          vm_config.placement == "spread-by-zone" ? local.vm_host_zones[local.placed_hosts[vm_key][i]] : null
+        )
         pool = vm_config.pool
         # Build key
         key = "${vm_key}-${i}"
         # Build hostname
-        hostname      = "${coalesce(vm_config.hostname_prefix, vm_key)}-${i}"
-        cores         = vm_config.cores
-        pinned_cores  = vm_config.pinned_cores
-        memory        = vm_config.memory
-        storage_disks = vm_config.storage_disks
-        network       = vm_config.network
-        tags          = vm_config.tags
+        hostname = "${coalesce(vm_config.hostname_prefix, vm_key)}-${i}"
+        cores    = vm_config.cores
+        # pinned_cores and numa_nodes are optional per-instance lists; assign element i when available, otherwise use last element
+        pinned_cores     = vm_config.pinned_cores != null ? (length(vm_config.pinned_cores) > i ? vm_config.pinned_cores[i] : vm_config.pinned_cores[length(vm_config.pinned_cores) - 1]) : null
+        numa_node        = vm_config.numa_nodes != null ? (length(vm_config.numa_nodes) > i ? vm_config.numa_nodes[i] : vm_config.numa_nodes[length(vm_config.numa_nodes) - 1]) : null
+        hugepages_backed = vm_config.hugepages_backed
+        memory           = vm_config.memory
+        storage_disks    = local.instance_storage_disks[vm_key][i]
+        # Each interface gets this instance's address: ip_address, ip_addresses[i]
+        # or ip_address_start + i within subnet_cidr (validated in variables.tf)
+        network = vm_config.network == null ? null : [
+          for nic in vm_config.network : merge(nic, {
+            ip_address = (
+              nic.ip_addresses != null ? nic.ip_addresses[i] :
+              nic.ip_address_start != null ? cidrhost(nic.subnet_cidr,
+                sum([for idx, octet in split(".", nic.ip_address_start) : tonumber(octet) * pow(256, 3 - idx)]) -
+                sum([for idx, octet in split(".", cidrhost(nic.subnet_cidr, 0)) : tonumber(octet) * pow(256, 3 - idx)]) + i
+              ) :
+              nic.ip_address
+            )
+          })
+        ]
+        tags = vm_config.tags
+        # Post-compose configuration
+        network_profile = vm_config.network_profile
+        storage_profile = vm_config.storage_profile
+        storage_devices = vm_config.storage_devices
+        deploy          = vm_config.deploy
       }
     ]
   ])
 
+  # Instances placed on a NUMA node take their pinned cores from numa_topology,
+  # in order: each gets the cores after those of earlier instances on the same
+  # host and node
+  numa_instances = [
+    for vm in local.vm_instances : vm if vm.pinned_cores == null && vm.numa_node != null
+  ]
+  numa_offsets = {
+    for idx, vm in local.numa_instances : vm.key => sum(concat([0], [
+      for prev in slice(local.numa_instances, 0, idx) : prev.cores
+      if prev.vm_host == vm.vm_host && prev.numa_node == vm.numa_node
+    ]))
+  }
+  numa_pinned_cores = {
+    for vm in local.numa_instances : vm.key => (
+      local.numa_offsets[vm.key] + vm.cores <= length(try(var.numa_topology[vm.vm_host][tostring(vm.numa_node)], []))
+      ? slice(var.numa_topology[vm.vm_host][tostring(vm.numa_node)], local.numa_offsets[vm.key], local.numa_offsets[vm.key] + vm.cores)
+      : null
+    )
+  }
+
   # Create a map for easier resource creation
   vm_instances_map = {
-    for vm in local.vm_instances : vm.key => vm
+    for vm in local.vm_instances : vm.key => merge(vm, {
+      pinned_cores = vm.pinned_cores != null ? vm.pinned_cores : lookup(local.numa_pinned_cores, vm.key, null)
+    })
+  }
+
+  # Tagged disks, by position in the composed disk order
+  disk_tags = merge([
+    for vm in local.vm_instances : {
+      for index, disk in vm.storage_disks : "${vm.key}.${index}" => {
+        vm_key = vm.key
+        index  = index
+        tags   = disk.tags
+      } if length(disk.tags) > 0
+    }
+  ]...)
+
+  # Post-compose configuration: VMs are commissioned by MAAS after composition,
+  # then configured by the node networking and storage modules and deployed
+  network_vms  = { for vm in local.vm_instances : vm.key => vm if vm.network_profile != null }
+  storage_vms  = { for vm in local.vm_instances : vm.key => vm if vm.storage_profile != null }
+  deploy_vms   = { for vm in local.vm_instances : vm.key => vm if vm.deploy != null }
+  post_compose = length(local.network_vms) + length(local.storage_vms) + length(local.deploy_vms) > 0
+
+  # Physical interfaces of each network profile, looked up on every VM using it
+  vm_physical_interfaces = merge([
+    for vm_key, vm in local.network_vms : {
+      for iface_key, iface in try(var.network_profiles[vm.network_profile].physical_interfaces, {}) :
+      "${vm_key}.${iface_key}" => {
+        vm_key    = vm_key
+        iface_key = iface_key
+        name      = coalesce(try(iface.name, null), iface_key)
+      }
+    }
+  ]...)
+
+  # VM hosts, zones and resource pools referenced by name (or ID), resolved
+  # through data sources so that an unknown name fails the plan
+  vm_host_refs       = toset(flatten([for vm_key, vm_config in var.vm_configurations : vm_config.vm_host]))
+  zone_refs          = toset([for vm in local.vm_instances : vm.zone if vm.zone != null])
+  resource_pool_refs = toset([for vm in local.vm_instances : vm.pool if vm.pool != null])
+
+  # VM keys per tag name, aggregated across all composed VMs
+  tag_vms = {
+    for tag in distinct(flatten([for vm in local.vm_instances : vm.tags])) :
+    tag => [for vm in local.vm_instances : vm.key if contains(vm.tags, tag)]
+  }
+
+  # Tags this module creates, and VMs to add to tags another unit creates
+  # (managed_tags), which this module must not take over
+  owned_tag_vms = { for tag, vm_keys in local.tag_vms : tag => vm_keys if !contains(var.managed_tags, tag) }
+  managed_tag_vms = merge([
+    for vm in local.vm_instances : {
+      for tag in vm.tags : "${vm.key}.${tag}" => {
+        vm_key = vm.key
+        tag    = tag
+      } if contains(var.managed_tags, tag)
+    }
+  ]...)
+}
+
+data "maas_vm_host" "vm_host" {
+  for_each = local.vm_host_refs
+
+  name = each.key
+}
+
+data "maas_zone" "zone" {
+  for_each = local.zone_refs
+
+  name = each.key
+}
+
+data "maas_resource_pool" "pool" {
+  for_each = local.resource_pool_refs
+
+  name = each.key
+}
+
+# Capacity-aware scheduling: maas-vm-schedule reads the free cores, memory and
+# storage pool space of every VM host from MAAS and picks a host for each
+# capacity-placed instance, failing the plan with a capacity report when they
+# do not fit. Instances that already exist keep their VM host.
+data "external" "schedule" {
+  count = local.capacity_placement ? 1 : 0
+
+  program = var.schedule_command
+
+  query = {
+    policy   = var.capacity_policy
+    requests = jsonencode(local.schedule_requests)
   }
 }
 
+locals {
+  # Zone of every referenced VM host, as registered in MAAS
+  vm_host_zones = { for name, vm_host in data.maas_vm_host.vm_host : name => vm_host.zone }
+
+  # VM host chosen by maas-vm-schedule for each capacity-placed instance
+  scheduled_hosts = local.capacity_placement ? data.external.schedule[0].result : {}
+}
+
 resource "maas_vm_host_machine" "vm" {
   for_each = local.vm_instances_map
 
-  vm_host  = each.value.vm_host
-  cores    = each.value.cores
-  memory   = each.value.memory
-  hostname = each.value.hostname
-  pool     = each.value.pool
-  zone     = each.value.zone
+  # Capacity-placed instances already carry the ID chosen by maas-vm-schedule
+  vm_host = contains(keys(data.maas_vm_host.vm_host), each.value.vm_host) ? data.maas_vm_host.vm_host[each.value.vm_host].id : each.value.vm_host
+  # MAAS derives the core count from pinned_cores when cores are pinned
+  cores            = each.value.pinned_cores != null ? null : each.value.cores
+  pinned_cores     = each.value.pinned_cores
+  hugepages_backed = each.value.hugepages_backed
+  memory           = each.value.memory
+  hostname         = each.value.hostname
+  pool             = each.value.pool != null ? data.maas_resource_pool.pool[each.value.pool].name : null
+  zone             = each.value.zone != null ? data.maas_zone.zone[each.value.zone].name : null
 
   dynamic "storage_disks" {
-    for_each = each.value.storage_disks != null ? each.value.storage_disks : []
+    for_each = each.value.storage_disks
     content {
       size_gigabytes = storage_disks.value.size_gigabytes
       pool           = storage_disks.value.pool
@@ -67,22 +290,260 @@ resource "maas_vm_host_machine" "vm" {
       ip_address  = network_interfaces.value.ip_address
     }
   }
+
+  lifecycle {
+    precondition {
+      condition     = each.value.numa_node == null || each.value.pinned_cores != null
+      error_message = "VM ${each.key} cannot be placed on its NUMA node: the node is missing from numa_topology for its VM host or has fewer free cores than requested."
+    }
+  }
 }
 
-# Apply tags to VMs
+# One tag per name, listing every VM carrying it plus any externally managed
+# members, so VMs sharing a tag do not overwrite each other's membership
 resource "maas_tag" "vm_tags" {
-  for_each = {
-    for item in flatten([
-      for vm_key, vm in local.vm_instances_map : [
-        for tag in vm.tags : {
-          key      = "${vm_key}-${tag}"
-          tag      = tag
-          machines = [maas_vm_host_machine.vm[vm_key].id]
+  for_each = local.owned_tag_vms
+
+  name = each.key
+  machines = distinct(concat(
+    [for vm_key in each.value : maas_vm_host_machine.vm[vm_key].id],
+    lookup(var.external_tag_machines, each.key, [])
+  ))
+}
+
+# Add VMs to tags created by another unit. maas_tag would take over the whole
+# tag, so VMs are added with the MAAS CLI; they leave the tag when deleted.
+resource "null_resource" "managed_tags" {
+  for_each = local.managed_tag_vms
+
+  triggers = {
+    machine_id = maas_vm_host_machine.vm[each.value.vm_key].id
+    tag        = each.value.tag
+  }
+
+  provisioner "local-exec" {
+    command = <<-EOT
+      set -euo pipefail
+
+      # VMs are tagged in parallel, so each run logs in with its own profile
+      # rather than overwriting a shared one another run is using
+      profile="$MAAS_PROFILE-tag-$MACHINE_ID-$TAG-$$"
+      maas login "$profile" "$MAAS_API_URL" "$MAAS_API_KEY" > /dev/null
+      trap 'maas logout "$profile" > /dev/null 2>&1 || true' EXIT
+
+      maas "$profile" tag update-nodes "$TAG" add="$MACHINE_ID" > /dev/null
+      echo "Added $MACHINE_ID to tag $TAG"
+    EOT
+
+    interpreter = ["bash", "-c"]
+
+    environment = {
+      MAAS_PROFILE = var.maas_profile
+      MAAS_API_URL = var.maas_api_url
+      MAAS_API_KEY = var.maas_api_key
+      MACHINE_ID   = maas_vm_host_machine.vm[each.value.vm_key].id
+      TAG          = each.value.tag
+    }
+  }
+}
+
+# Tag composed disks. MAAS composes the disks in order, so a disk's position
+# among the VM's physical block devices (by ID) identifies it. Tags are only
+# added; tags removed from the configuration stay on the disk.
+resource "null_resource" "disk_tags" {
+  for_each = local.disk_tags
+
+  triggers = {
+    machine_id = maas_vm_host_machine.vm[each.value.vm_key].id
+    index      = each.value.index
+    tags       = join(",", each.value.tags)
+  }
+
+  provisioner "local-exec" {
+    command = <<-EOT
+      set -euo pipefail
+
+      # Disks are tagged in parallel, so each run logs in with its own profile
+      # rather than overwriting a shared one another run is using
+      profile="$MAAS_PROFILE-disk-tags-$MACHINE_ID-$DISK_INDEX-$$"
+      maas login "$profile" "$MAAS_API_URL" "$MAAS_API_KEY" > /dev/null
+      trap 'maas logout "$profile" > /dev/null 2>&1 || true' EXIT
+
+      device_id=$(maas "$profile" block-devices read "$MACHINE_ID" |
+        jq -r --argjson index "$DISK_INDEX" '[.[] | select(.type == "physical")] | sort_by(.id) | .[$index].id // empty')
+      if [ -z "$device_id" ]; then
+        echo "Disk $DISK_INDEX of $MACHINE_ID not found" >&2
+        exit 1
+      fi
+
+      for tag in $${DISK_TAGS//,/ }; do
+        maas "$profile" block-device add-tag "$MACHINE_ID" "$device_id" tag="$tag" > /dev/null
+      done
+      echo "Tagged disk $DISK_INDEX of $MACHINE_ID: $DISK_TAGS"
+    EOT
+
+    interpreter = ["bash", "-c"]
+
+    environment = {
+      MAAS_PROFILE = var.maas_profile
+      MAAS_API_URL = var.maas_api_url
+      MAAS_API_KEY = var.maas_api_key
+      MACHINE_ID   = maas_vm_host_machine.vm[each.value.vm_key].id
+      DISK_INDEX   = each.value.index
+      DISK_TAGS    = join(",", each.value.tags)
+    }
+  }
+}
+
+# Wait until MAAS has commissioned the composed VMs. When the module
+# configures or deploys them, this gates the configuration and maas_instance
+# on Ready, never on wait_for_state: waiting for Ready also accepts the
+# Allocated and Deployed VMs maas_instance leaves behind, so later plans pass
+module "vms_ready" {
+  source = "../maas-wait-for-machines"
+  count  = var.wait_for_state != null || local.post_compose ? 1 : 0
+
+  machines     = [for vm in maas_vm_host_machine.vm : vm.hostname]
+  target_state = local.post_compose ? "Ready" : var.wait_for_state
+  timeout      = var.wait_timeout
+  wait_command = var.wait_command
+}
+
+# MAC addresses of the composed interfaces, for the network profile
+data "maas_network_interface_physical" "vm" {
+  for_each = local.vm_physical_interfaces
+
+  machine = maas_vm_host_machine.vm[each.value.vm_key].id
+  name    = each.value.name
+
+  depends_on = [module.vms_ready]
+}
+
+# Apply network profiles with the node networking module. Static addresses of
+# the composed interfaces are kept on the profile's STATIC links.
+module "vm_networking" {
+  source = "../maas-configure-nodes-networking"
+  count  = length(local.network_vms) > 0 ? 1 : 0
+
+  network_profiles = var.network_profiles
+  nodes = {
+    for vm_key, vm in local.network_vms : vm.hostname => {
+      network_profile = vm.network_profile
+      physical_interfaces = {
+        for iface_key, iface in try(var.network_profiles[vm.network_profile].physical_interfaces, {}) : iface_key => {
+          mac_address = data.maas_network_interface_physical.vm["${vm_key}.${iface_key}"].mac_address
         }
-      ]
-    ]) : item.key => item
+      }
+      static_ip_addresses = {
+        for nic in vm.network == null ? [] : vm.network : nic.name => {
+          interface_name = nic.name
+          subnet_id = one([
+            for link in values(try(var.network_profiles[vm.network_profile].interface_links, {})) :
+            link.subnet_id if link.network_interface == nic.name && link.mode == "STATIC"
+          ])
+          ip_address = nic.ip_address
+          } if nic.ip_address != null && length([
+            for link in values(try(var.network_profiles[vm.network_profile].interface_links, {})) :
+            link if link.network_interface == nic.name && link.mode == "STATIC"
+        ]) == 1
+      }
+    }
   }
 
-  name     = each.value.tag
-  machines = each.value.machines
+  maas_api_url = var.maas_api_url
+  maas_api_key = var.maas_api_key
+  maas_profile = var.maas_profile
+
+  depends_on = [module.vms_ready]
+}
+
+# Disks of each VM with a storage profile, in composed order
+data "external" "vm_block_devices" {
+  for_each = local.storage_vms
+
+  program = var.block_devices_command
+
+  query = {
+    machine = maas_vm_host_machine.vm[each.key].id
+  }
+
+  depends_on = [module.vms_ready]
+
+  lifecycle {
+    postcondition {
+      condition     = tonumber(self.result.count) >= length(each.value.storage_devices)
+      error_message = "VM ${each.key} has fewer disks than storage_devices."
+    }
+  }
+}
+
+# Apply storage profiles with the node storage module, mapping the profile's
+# device roles (storage_devices) to the composed disks
+module "vm_storage" {
+  source = "../maas-configure-nodes-storage"
+  count  = length(local.storage_vms) > 0 ? 1 : 0
+
+  storage_profiles = var.storage_profiles
+  nodes = {
+    for vm_key, vm in local.storage_vms : vm.hostname => {
+      hostname        = vm.hostname
+      storage_profile = vm.storage_profile
+      devices = {
+        for index, role in vm.storage_devices : role => {
+          name           = data.external.vm_block_devices[vm_key].result["${index}.name"]
+          id_path        = data.external.vm_block_devices[vm_key].result["${index}.id_path"] != "" ? data.external.vm_block_devices[vm_key].result["${index}.id_path"] : null
+          model          = data.external.vm_block_devices[vm_key].result["${index}.model"] != "" ? data.external.vm_block_devices[vm_key].result["${index}.model"] : null
+          serial         = data.external.vm_block_devices[vm_key].result["${index}.serial"] != "" ? data.external.vm_block_devices[vm_key].result["${index}.serial"] : null
+          size_gigabytes = tonumber(data.external.vm_block_devices[vm_key].result["${index}.size_gigabytes"])
+          is_boot_device = index == 0
+          tags           = try(vm.storage_disks[index].tags, [])
+        }
+      }
+    }
+  }
+
+  depends_on = [module.vms_ready]
+}
+
+# Deploy an OS on configured VMs
+resource "maas_instance" "vm" {
+  for_each = local.deploy_vms
+
+  allocate_params {
+    system_id = maas_vm_host_machine.vm[each.key].id
+  }
+
+  deploy_params {
+    distro_series = each.value.deploy.distro_series
+    hwe_kernel    = each.value.deploy.hwe_kernel
+    user_data     = each.value.deploy.user_data
+  }
+
+  depends_on = [module.vms_ready, module.vm_networking, module.vm_storage]
+}
+
+locals {
+  # Every composed VM as downstream units consume it: FQDN and the address of
+  # each network interface, either its static address or the deployed address
+  # inside the interface's subnet
+  vm_details = {
+    for k, vm in local.vm_instances_map : k => {
+      key           = k
+      configuration = vm.config_key
+      hostname      = maas_vm_host_machine.vm[k].hostname
+      fqdn          = try(maas_instance.vm[k].fqdn, "${maas_vm_host_machine.vm[k].hostname}.${var.domain}")
+      system_id     = maas_vm_host_machine.vm[k].id
+      vm_host       = maas_vm_host_machine.vm[k].vm_host
+      zone          = vm.zone
+      tags          = vm.tags
+      ip_addresses = {
+        for nic in vm.network == null ? [] : vm.network : nic.name => (
+          nic.ip_address != null ? nic.ip_address : try([
+            for ip in maas_instance.vm[k].ip_addresses : ip
+            if nic.subnet_cidr != null && can(cidrhost("${ip}/${split("/", nic.subnet_cidr)[1]}", 0)) && try(cidrhost("${ip}/${split("/", nic.subnet_cidr)[1]}", 0) == cidrhost(nic.subnet_cidr, 0), false)
+          ][0], null)
+        )
+      }
+    }
+  }
 }
@@ -23,3 +23,51 @@ output "vm_system_ids" {
   description = "Map of VM keys to their system IDs"
   value       = { for k, vm in maas_vm_host_machine.vm : k => vm.id }
 }
+
+output "vm_tags" {
+  description = "Map of tag names to the system IDs of the machines carrying them"
+  value = merge(
+    { for tag, t in maas_tag.vm_tags : tag => t.machines },
+    { for tag, vm_keys in local.tag_vms : tag => [for vm_key in vm_keys : maas_vm_host_machine.vm[vm_key].id] if contains(var.managed_tags, tag) }
+  )
+}
+
+output "deployed_vms" {
+  description = "Map of deployed VM keys to their FQDN and IP addresses"
+  value = {
+    for k, instance in maas_instance.vm : k => {
+      hostname     = maas_vm_host_machine.vm[k].hostname
+      fqdn         = instance.fqdn
+      ip_addresses = instance.ip_addresses
+    }
+  }
+}
+
+output "vm_ip_addresses" {
+  description = "Map of VM hostnames to their IP addresses: deployed addresses, or the static addresses of composed interfaces (e.g. for the juju-bootstrap unit)"
+  value = merge(
+    {
+      for vm in local.vm_instances : vm.hostname => [for nic in vm.network : nic.ip_address if nic.ip_address != null]
+      if vm.network != null
+    },
+    { for k, instance in maas_instance.vm : maas_vm_host_machine.vm[k].hostname => tolist(instance.ip_addresses) }
+  )
+}
+
+output "vms_by_configuration" {
+  description = "Map of vm_configurations keys to their VMs (hostname, FQDN, system ID, VM host, zone, tags and IP address per network interface)"
+  value = {
+    for config_key in keys(var.vm_configurations) : config_key => [
+      for vm in local.vm_instances : local.vm_details[vm.key] if vm.config_key == config_key
+    ]
+  }
+}
+
+output "vms_by_tag" {
+  description = "Map of tag names (e.g. juju-controller) to the VMs carrying them, in the format of vms_by_configuration"
+  value = {
+    for tag in keys(local.tag_vms) : tag => [
+      for vm_key in local.tag_vms[tag] : local.vm_details[vm_key]
+    ]
+  }
+}
@@ -1,26 +1,64 @@
 variable "vm_configurations" {
   description = "Map of VM configurations to create. Each configuration can specify a count for multiple instances."
   type = map(object({
-    vm_host         = list(string)
+    # VM host names (or IDs), resolved through the maas_vm_host data source
+    vm_host = list(string)
+    # How instances are assigned to vm_host: explicit, round-robin, spread-by-zone, anti-affinity or capacity
+    placement       = optional(string, "explicit")
     hostname_prefix = optional(string)
     count           = number
     cores           = number
-    pinned_cores    = optional(list(number))
-    memory          = number
-    pool            = optional(string)
-    zone            = optional(list(string))
+    # Per-instance host cores to pin to; pinned_cores[i] -> instance i (last entry reused)
+    pinned_cores = optional(list(list(number)))
+    # Per-instance NUMA node; cores are pinned from numa_topology for the VM host
+    numa_nodes       = optional(list(number))
+    hugepages_backed = optional(bool, false)
+    memory           = number
+    pool             = optional(string)
+    zone             = optional(list(string))
     storage_disks = optional(list(object({
       size_gigabytes = number
       pool           = optional(string)
+      # The boot disk is composed first; without one, the first disk boots
+      boot = optional(bool, false)
+      # Block device tags, e.g. to select data disks in storage layouts
+      tags = optional(list(string), [])
     })))
+    # Per-instance storage_disks replacing the shared list, keyed by instance index
+    storage_disk_overrides = optional(map(list(object({
+      size_gigabytes = number
+      pool           = optional(string)
+      boot           = optional(bool, false)
+      tags           = optional(list(string), [])
+    }))), {})
     network = optional(list(object({
       name        = string
       fabric      = optional(string)
       vlan        = optional(string)
       subnet_cidr = optional(string)
-      ip_address  = optional(string)
+      # Static address of a single instance; use ip_addresses or
+      # ip_address_start to give each of count instances its own address
+      ip_address = optional(string)
+      # Per-instance addresses: ip_addresses[i] -> instance i
+      ip_addresses = optional(list(string))
+      # First address of a contiguous block: instance i gets start + i (IPv4)
+      ip_address_start = optional(string)
     })))
     tags = optional(list(string), [])
+
+    # Post-compose configuration, applied once the VMs are Ready
+    # Network profile from network_profiles, applied by maas-configure-nodes-networking
+    network_profile = optional(string)
+    # Storage profile from storage_profiles, applied by maas-configure-nodes-storage;
+    # storage_devices names the profile device role of each disk, in composed order
+    storage_profile = optional(string)
+    storage_devices = optional(list(string), [])
+    # Deploy an OS once configured
+    deploy = optional(object({
+      distro_series = optional(string)
+      hwe_kernel    = optional(string)
+      user_data     = optional(string)
+    }))
   }))
 
   validation {
@@ -30,6 +68,27 @@ variable "vm_configurations" {
     error_message = "Count must be greater than 0 for all VM configurations."
   }
 
+  validation {
+    condition = alltrue([
+      for k, v in var.vm_configurations : length(v.vm_host) > 0 || v.placement == "capacity"
+    ])
+    error_message = "vm_host must list at least one VM host for all VM configurations not using capacity placement."
+  }
+
+  validation {
+    condition = alltrue([
+      for k, v in var.vm_configurations : contains(["explicit", "round-robin", "spread-by-zone", "anti-affinity", "capacity"], v.placement)
+    ])
+    error_message = "placement must be one of explicit, round-robin, spread-by-zone, anti-affinity, capacity."
+  }
+
+  validation {
+    condition = alltrue([
+      for k, v in var.vm_configurations : v.placement != "anti-affinity" || v.count <= length(distinct(v.vm_host))
+    ])
+    error_message = "Anti-affinity placement needs at least as many distinct vm_host entries as count: ${join(", ", [for k, v in var.vm_configurations : "${k} (${v.count} VMs, ${length(distinct(v.vm_host))} hosts)" if v.placement == "anti-affinity" && v.count > length(distinct(v.vm_host))])}."
+  }
+
   validation {
     condition = alltrue([
       for k, v in var.vm_configurations : v.cores > 0
@@ -43,4 +102,245 @@ variable "vm_configurations" {
     ])
     error_message = "Memory must be greater than 0 for all VM configurations."
   }
+
+  validation {
+    condition = alltrue([
+      for k, v in var.vm_configurations : v.pinned_cores == null ? true : alltrue([
+        for cores in v.pinned_cores : length(cores) == v.cores
+      ])
+    ])
+    error_message = "Every pinned_cores list must have exactly as many entries as cores."
+  }
+
+  validation {
+    condition = alltrue([
+      for k, v in var.vm_configurations : v.pinned_cores == null || v.numa_nodes == null
+    ])
+    error_message = "pinned_cores and numa_nodes are mutually exclusive; pin cores explicitly or place VMs on NUMA nodes."
+  }
+
+  validation {
+    condition = alltrue([
+      for k, v in var.vm_configurations : v.numa_nodes == null ? true : alltrue([
+        for node in v.numa_nodes : node >= 0 && floor(node) == node
+      ])
+    ])
+    error_message = "NUMA nodes must be non-negative integers."
+  }
+
+  validation {
+    condition = alltrue([
+      for k, v in var.vm_configurations : v.storage_profile == null || length(v.storage_devices) > 0
+    ])
+    error_message = "storage_profile requires storage_devices, the profile device role of each composed disk."
+  }
+
+  validation {
+    condition = alltrue(flatten([
+      for k, v in var.vm_configurations : [
+        for disks in concat([v.storage_disks == null ? [] : v.storage_disks], values(v.storage_disk_overrides)) :
+        length([for disk in disks : disk if disk.boot]) <= 1
+      ]
+    ]))
+    error_message = "At most one storage disk of a VM can be the boot disk."
+  }
+
+  validation {
+    condition = alltrue(flatten([
+      for k, v in var.vm_configurations : [
+        for index in keys(v.storage_disk_overrides) : can(tonumber(index)) ? tonumber(index) >= 0 && tonumber(index) < v.count && floor(tonumber(index)) == tonumber(index) : false
+      ]
+    ]))
+    error_message = "storage_disk_overrides keys must be instance indexes from 0 to count - 1."
+  }
+
+  validation {
+    condition = alltrue(flatten([
+      for k, v in var.vm_configurations : [
+        for disks in concat([v.storage_disks == null ? [] : v.storage_disks], values(v.storage_disk_overrides)) : [
+          for disk in disks : disk.size_gigabytes > 0 && alltrue([for tag in disk.tags : can(regex("^[a-zA-Z0-9_-]+$", tag))])
+        ]
+      ]
+    ]))
+    error_message = "Storage disks must have a positive size_gigabytes, and disk tags may only contain letters, digits, hyphens and underscores."
+  }
+
+  validation {
+    condition = alltrue(flatten([
+      for k, v in var.vm_configurations : [
+        for nic in v.network == null ? [] : v.network : length(compact([
+          nic.ip_address != null ? "ip_address" : "",
+          nic.ip_addresses != null ? "ip_addresses" : "",
+          nic.ip_address_start != null ? "ip_address_start" : "",
+        ])) <= 1
+      ]
+    ]))
+    error_message = "A network interface can set only one of ip_address, ip_addresses and ip_address_start."
+  }
+
+  validation {
+    condition = alltrue(flatten([
+      for k, v in var.vm_configurations : [
+        for nic in v.network == null ? [] : v.network : nic.ip_address == null || v.count == 1
+      ]
+    ]))
+    error_message = "ip_address gives every instance the same address; use ip_addresses or ip_address_start when count is greater than 1: ${join(", ", [for k, v in var.vm_configurations : k if v.count > 1 && anytrue([for nic in v.network == null ? [] : v.network : nic.ip_address != null])])}."
+  }
+
+  validation {
+    condition = alltrue(flatten([
+      for k, v in var.vm_configurations : [
+        for nic in v.network == null ? [] : v.network : nic.subnet_cidr != null if nic.ip_address != null || nic.ip_addresses != null || nic.ip_address_start != null
+      ]
+    ]))
+    error_message = "Static addresses (ip_address, ip_addresses, ip_address_start) require subnet_cidr on the network interface."
+  }
+
+  validation {
+    condition = alltrue(flatten([
+      for k, v in var.vm_configurations : [
+        for nic in v.network == null ? [] : v.network : length(nic.ip_addresses) >= v.count if nic.ip_addresses != null
+      ]
+    ]))
+    error_message = "ip_addresses must list an address for each of count instances."
+  }
+
+  validation {
+    # An address is in subnet_cidr when it has the same network address under
+    # the subnet's prefix length
+    condition = alltrue(flatten([
+      for k, v in var.vm_configurations : [
+        for nic in v.network == null ? [] : v.network : [
+          for ip in compact(concat([nic.ip_address], nic.ip_addresses == null ? [] : nic.ip_addresses)) :
+          can(cidrhost("${ip}/${split("/", nic.subnet_cidr)[1]}", 0) == cidrhost(nic.subnet_cidr, 0)) ? cidrhost("${ip}/${split("/", nic.subnet_cidr)[1]}", 0) == cidrhost(nic.subnet_cidr, 0) : false
+        ] if nic.subnet_cidr != null
+      ]
+    ]))
+    error_message = "Static addresses must be valid addresses inside the network interface's subnet_cidr."
+  }
+
+  validation {
+    # Instance count - 1 gets start + count - 1, which must still be inside subnet_cidr
+    condition = alltrue(flatten([
+      for k, v in var.vm_configurations : [
+        for nic in v.network == null ? [] : v.network : can(regex("^\\d+\\.\\d+\\.\\d+\\.\\d+$", nic.ip_address_start)) ? can(cidrhost(nic.subnet_cidr,
+          sum([for idx, octet in split(".", nic.ip_address_start) : tonumber(octet) * pow(256, 3 - idx)]) -
+          sum([for idx, octet in split(".", cidrhost(nic.subnet_cidr, 0)) : tonumber(octet) * pow(256, 3 - idx)]) + v.count - 1
+        )) && cidrhost("${nic.ip_address_start}/${split("/", nic.subnet_cidr)[1]}", 0) == cidrhost(nic.subnet_cidr, 0) : false
+        if nic.ip_address_start != null && nic.subnet_cidr != null
+      ]
+    ]))
+    error_message = "ip_address_start must be an IPv4 address inside subnet_cidr, leaving room for count addresses."
+  }
+
+  validation {
+    condition = length(flatten([
+      for k, v in var.vm_configurations : [
+        for nic in v.network == null ? [] : v.network : nic.ip_addresses == null ? [] : nic.ip_addresses
+      ]
+      ])) == length(distinct(flatten([
+        for k, v in var.vm_configurations : [
+          for nic in v.network == null ? [] : v.network : nic.ip_addresses == null ? [] : nic.ip_addresses
+        ]
+    ])))
+    error_message = "ip_addresses must not repeat an address."
+  }
+}
+
+variable "capacity_policy" {
+  description = "How capacity-placed VMs choose among the VM hosts they fit on: bin-pack (fullest host first) or spread (emptiest host first)"
+  type        = string
+  default     = "bin-pack"
+
+  validation {
+    condition     = contains(["bin-pack", "spread"], var.capacity_policy)
+    error_message = "capacity_policy must be bin-pack or spread."
+  }
+}
+
+variable "schedule_command" {
+  description = "Command running the maas-vm-schedule tool (see tools/cmd/maas-vm-schedule)"
+  type        = list(string)
+  default     = ["maas-vm-schedule"]
+}
+
+variable "network_profiles" {
+  description = "Network profiles referenced by network_profile, in the format of maas-configure-nodes-networking's network_profiles"
+  type        = any
+  default     = {}
+}
+
+variable "storage_profiles" {
+  description = "Storage profiles referenced by storage_profile, in the format of maas-configure-nodes-storage's storage_profiles"
+  type        = any
+  default     = {}
+}
+
+# Readiness gate: wait for composed VMs to finish commissioning
+variable "wait_for_state" {
+  description = "State composed VMs must reach after composition (Ready, Allocated or Deployed); null waits only when VMs are configured or deployed. VMs the module configures or deploys are always waited for until Ready, before configuration"
+  type        = string
+  default     = null
+}
+
+variable "wait_timeout" {
+  description = "How long to wait for composed VMs to reach wait_for_state, as a Go duration (e.g. 30m)"
+  type        = string
+  default     = "30m"
+}
+
+variable "wait_command" {
+  description = "Command running the maas-wait tool (see tools/cmd/maas-wait)"
+  type        = list(string)
+  default     = ["maas-wait"]
+}
+
+variable "domain" {
+  description = "DNS domain of the composed VMs, used for the FQDNs of VMs that are not deployed by this module"
+  type        = string
+  default     = "maas"
+}
+
+variable "block_devices_command" {
+  description = "Command running the maas-block-devices tool (see tools/cmd/maas-block-devices)"
+  type        = list(string)
+  default     = ["maas-block-devices"]
+}
+
+variable "maas_profile" {
+  description = "MAAS CLI profile name to use for local-exec provisioners"
+  type        = string
+  default     = "root"
+}
+
+# MAAS API credentials, used by local-exec provisioners (the provider is
+# configured by the unit)
+variable "maas_api_url" {
+  description = "MAAS API URL"
+  type        = string
+  sensitive   = true
+}
+
+variable "maas_api_key" {
+  description = "MAAS API Key"
+  type        = string
+  sensitive   = true
+}
+
+variable "numa_topology" {
+  description = "Host CPU cores per NUMA node, keyed by VM host then NUMA node index (e.g. { \"vmhost-1\" = { \"0\" = [0, 1, 2, 3] } }). Required for VMs placed with numa_nodes."
+  type        = map(map(list(number)))
+  default     = {}
+}
+
+variable "managed_tags" {
+  description = "Names of tags created by another unit (e.g. maas-config). VMs carrying them are added to the existing tag instead of this module creating and owning it."
+  type        = list(string)
+  default     = []
+}
+
+variable "external_tag_machines" {
+  description = "System IDs of machines tagged outside this module, keyed by tag name. They are kept in the membership of tags this module manages."
+  type        = map(list(string))
+  default     = {}
 }
@@ -0,0 +1,49 @@
+# MAAS Configuration Module
+# Manages zones, resource pools, tags, DNS domains and global settings that the
+# enlistment, commissioning and VM composition units reference by name
+
+resource "maas_zone" "zone" {
+  for_each = var.zones
+
+  name        = each.key
+  description = each.value.description
+}
+
+resource "maas_resource_pool" "pool" {
+  for_each = var.resource_pools
+
+  name        = each.key
+  description = each.value.description
+}
+
+# Manual tags, XPath definition tags (applied automatically by MAAS) and
+# kernel-option tags
+resource "maas_tag" "tag" {
+  for_each = var.tags
+
+  name        = each.key
+  comment     = each.value.comment
+  definition  = each.value.definition
+  kernel_opts = each.value.kernel_opts
+
+  # Machines are tagged by the units that own them
+  lifecycle {
+    ignore_changes = [machines]
+  }
+}
+
+resource "maas_dns_domain" "domain" {
+  for_each = var.domains
+
+  name          = each.key
+  ttl           = each.value.ttl
+  authoritative = each.value.authoritative
+  is_default    = each.value.is_default
+}
+
+resource "maas_configuration" "setting" {
+  for_each = var.maas_settings
+
+  key   = each.key
+  value = each.value
+}
@@ -0,0 +1,34 @@
+output "zones" {
+  description = "Map of zone names to IDs"
+  value       = { for name, zone in maas_zone.zone : name => zone.id }
+}
+
+output "resource_pools" {
+  description = "Map of resource pool names to IDs"
+  value       = { for name, pool in maas_resource_pool.pool : name => pool.id }
+}
+
+output "tags" {
+  description = "Map of tag names to their definition and kernel options"
+  value = {
+    for name, tag in maas_tag.tag : name => {
+      definition  = tag.definition
+      kernel_opts = tag.kernel_opts
+    }
+  }
+}
+
+output "domains" {
+  description = "Map of DNS domain names to IDs"
+  value       = { for name, domain in maas_dns_domain.domain : name => domain.id }
+}
+
+output "default_domain" {
+  description = "Name of the default DNS domain, or null when not managed here"
+  value       = one([for name, domain in var.domains : name if domain.is_default])
+}
+
+output "maas_settings" {
+  description = "Global MAAS settings managed by this module"
+  value       = { for key, setting in maas_configuration.setting : key => setting.value }
+}
@@ -0,0 +1,75 @@
+variable "zones" {
+  description = "Map of availability zones to create, keyed by zone name"
+  type = map(object({
+    description = optional(string, "")
+  }))
+  default = {}
+}
+
+variable "resource_pools" {
+  description = "Map of resource pools to create, keyed by pool name"
+  type = map(object({
+    description = optional(string, "")
+  }))
+  default = {}
+}
+
+variable "tags" {
+  description = "Map of tags to create, keyed by tag name"
+  type = map(object({
+    comment = optional(string, "")
+    # XPath expression evaluated against commissioning data; MAAS applies
+    # the tag automatically to every matching machine
+    definition = optional(string)
+    # Kernel options appended to the boot command line of tagged machines
+    kernel_opts = optional(string)
+  }))
+  default = {}
+
+  validation {
+    condition = alltrue([
+      for name, tag in var.tags : can(regex("^[a-zA-Z0-9_-]+$", name))
+    ])
+    error_message = "Tag names may only contain letters, digits, hyphens and underscores."
+  }
+
+  validation {
+    condition = alltrue([
+      for name, tag in var.tags : tag.definition == null ? true : trimspace(tag.definition) != ""
+    ])
+    error_message = "Tag definitions must be non-empty XPath expressions; omit definition for manual tags."
+  }
+}
+
+variable "domains" {
+  description = "Map of DNS domains to create, keyed by domain name"
+  type = map(object({
+    ttl           = optional(number)
+    authoritative = optional(bool, true)
+    is_default    = optional(bool, false)
+  }))
+  default = {}
+
+  validation {
+    condition     = length([for name, domain in var.domains : name if domain.is_default]) <= 1
+    error_message = "At most one domain can be the default domain."
+  }
+}
+
+variable "maas_settings" {
+  description = "Global MAAS configuration settings (e.g. upstream_dns, ntp_servers, default_distro_series), keyed by setting name"
+  type        = map(string)
+  default     = {}
+}
+
+# MAAS API credentials
+variable "maas_api_url" {
+  description = "MAAS API URL"
+  type        = string
+}
+
+variable "maas_api_key" {
+  description = "MAAS API key for authentication"
+  type        = string
+  sensitive   = true
+}
@@ -3,17 +3,24 @@
 
 # Flatten the hierarchical structure for easier resource creation
 locals {
-  # Flatten VLANs from fabrics
+  # Flatten VLANs from fabrics. VLANs are keyed by name or vid in var.fabrics,
+  # but resources stay keyed by "<fabric>-<vid>" either way
   vlans_flat = flatten([
     for fabric_name, fabric in var.fabrics : [
-      for vlan_idx, vlan in fabric.vlans : {
-        key         = "${fabric_name}-${vlan.vid}"
+      for vlan_key, vlan in fabric.vlans : {
+        key         = "${fabric_name}-${vlan.vid != null ? vlan.vid : vlan_key}"
+        vlan_key    = vlan_key
+        name        = can(tonumber(vlan_key)) ? "${fabric_name}-${vlan_key}" : vlan_key
         fabric_name = fabric_name
-        vid         = vlan.vid
+        vid         = vlan.vid != null ? vlan.vid : tonumber(vlan_key)
         space       = try(vlan.space, null)
         dhcp_on     = try(vlan.dhcp_on, false)
         mtu         = try(vlan.mtu, 1500)
         subnets     = vlan.subnets
+
+        relay_vlan     = vlan.relay_vlan
+        primary_rack   = vlan.primary_rack
+        secondary_rack = vlan.secondary_rack
       }
     ]
   ])
@@ -28,7 +35,22 @@ locals {
         cidr        = subnet.cidr
         gateway_ip  = try(subnet.gateway_ip, null)
         dns_servers = try(subnet.dns_servers, [])
-        reserved    = try(subnet.reserved, {})
+        reserved    = subnet.reserved != null ? subnet.reserved : {}
+
+        allow_dns                   = subnet.allow_dns
+        allow_proxy                 = subnet.allow_proxy
+        rdns_mode                   = subnet.rdns_mode
+        managed                     = subnet.managed
+        active_discovery            = subnet.active_discovery
+        disabled_boot_architectures = subnet.disabled_boot_architectures
+
+        # IPv6 subnets get addresses from MAAS DHCPv6 when they have a dynamic
+        # range, otherwise from the router's advertisements (SLAAC). MAAS has
+        # no setting for the mode, so it is only reported, never sent
+        ip_version = can(regex(":", subnet.cidr)) ? 6 : 4
+        ipv6_mode = can(regex(":", subnet.cidr)) ? coalesce(subnet.ipv6_mode, contains([
+          for range in values(subnet.reserved != null ? subnet.reserved : {}) : range.type
+        ], "dynamic") ? "dhcpv6" : "slaac") : null
       }
     ]
   ])
@@ -51,6 +73,35 @@ locals {
   vlans_map     = { for vlan in local.vlans_flat : vlan.key => vlan }
   subnets_map   = { for subnet in local.subnets_flat : subnet.key => subnet }
   ip_ranges_map = { for range in local.ip_ranges_flat : range.key => range }
+
+  # VLANs whose DHCP is served by named rack controllers or relayed to another VLAN
+  vlan_dhcp_map = {
+    for key, vlan in local.vlans_map : key => vlan
+    if vlan.primary_rack != null || vlan.relay_vlan != null
+  }
+
+  # relay_vlan names a VLAN by "<fabric>-<vid>" or "<fabric>-<VLAN key>"
+  vlan_keys = merge(
+    { for vlan in local.vlans_flat : "${vlan.fabric_name}-${vlan.vlan_key}" => vlan.key },
+    { for vlan in local.vlans_flat : vlan.key => vlan.key }
+  )
+
+  rack_controllers = toset(compact(flatten([
+    for vlan in values(local.vlan_dhcp_map) : [vlan.primary_rack, vlan.secondary_rack]
+  ])))
+
+  # Static routes name subnets by subnet name (unique across fabrics) or by
+  # subnets_map key
+  subnet_keys = merge(
+    { for key, subnet in local.subnets_map : subnet.name => key },
+    { for key, subnet in local.subnets_map : key => key }
+  )
+  static_routes_map = {
+    for name, route in var.static_routes : name => merge(route, {
+      source_key      = lookup(local.subnet_keys, route.source, null)
+      destination_key = lookup(local.subnet_keys, route.destination, null)
+    })
+  }
 }
 
 # Space resources
@@ -60,6 +111,37 @@ resource "maas_space" "space" {
   name = each.key
 }
 
+# maas_space only manages the name, so descriptions are set with the MAAS CLI
+resource "null_resource" "space_description" {
+  for_each = { for name, space in var.spaces : name => space.description if space.description != null }
+
+  triggers = {
+    space_id    = maas_space.space[each.key].id
+    description = each.value
+  }
+
+  provisioner "local-exec" {
+    command     = <<-EOT
+      set -euo pipefail
+      # Spaces are updated in parallel, so each run logs in with its own
+      # profile rather than overwriting a shared one another run is using
+      profile="$MAAS_PROFILE-space-$SPACE_ID-$$"
+      maas login "$profile" "$MAAS_API_URL" "$MAAS_API_KEY" > /dev/null
+      trap 'maas logout "$profile" > /dev/null 2>&1 || true' EXIT
+      maas "$profile" space update "$SPACE_ID" description="$SPACE_DESCRIPTION" > /dev/null
+    EOT
+    interpreter = ["bash", "-c"]
+
+    environment = {
+      MAAS_PROFILE      = var.maas_profile
+      MAAS_API_URL      = var.maas_api_url
+      MAAS_API_KEY      = var.maas_api_key
+      SPACE_ID          = maas_space.space[each.key].id
+      SPACE_DESCRIPTION = each.value
+    }
+  }
+}
+
 # Fabric resources
 resource "maas_fabric" "fabric" {
   for_each = var.fabrics
@@ -71,12 +153,21 @@ resource "maas_fabric" "fabric" {
 resource "maas_vlan" "vlan" {
   for_each = local.vlans_map
 
-  fabric  = maas_fabric.fabric[each.value.fabric_name].id
-  vid     = each.value.vid
-  name    = "${each.value.fabric_name}-${each.value.vid}"
-  mtu     = each.value.mtu
-  dhcp_on = each.value.dhcp_on
-  space   = each.value.space
+  fabric = maas_fabric.fabric[each.value.fabric_name].id
+  vid    = each.value.vid
+  name   = each.value.name
+  mtu    = each.value.mtu
+  # DHCP of VLANs with racks or a relay is managed by maas_vlan_dhcp
+  dhcp_on = contains(keys(local.vlan_dhcp_map), each.key) ? null : each.value.dhcp_on
+  # Referencing maas_space.space orders the VLAN after its space on create and before it on destroy
+  space = each.value.space != null ? try(maas_space.space[each.value.space].name, each.value.space) : null
+
+  lifecycle {
+    precondition {
+      condition     = each.value.space == null || contains(keys(var.spaces), coalesce(each.value.space, "-"))
+      error_message = "VLAN ${each.key} references space \"${coalesce(each.value.space, "-")}\", which is not defined in var.spaces."
+    }
+  }
 }
 
 # Subnet resources
@@ -89,9 +180,13 @@ resource "maas_subnet" "subnet" {
   name        = each.value.name
   gateway_ip  = each.value.gateway_ip
   dns_servers = each.value.dns_servers
-  allow_dns   = true
-  allow_proxy = true
-  rdns_mode   = 2
+
+  allow_dns                   = each.value.allow_dns
+  allow_proxy                 = each.value.allow_proxy
+  rdns_mode                   = each.value.rdns_mode
+  managed                     = each.value.managed
+  active_discovery            = each.value.active_discovery
+  disabled_boot_architectures = each.value.disabled_boot_architectures
 }
 
 # IP ranges for subnets
@@ -104,3 +199,119 @@ resource "maas_subnet_ip_range" "ip_range" {
   end_ip   = each.value.end_ip
   comment  = each.value.name
 }
+
+# Rack controllers serving DHCP, looked up by hostname
+data "maas_rack_controller" "rack" {
+  for_each = local.rack_controllers
+
+  hostname = each.key
+}
+
+# DHCP served by rack controllers or relayed to another VLAN, enabled once the
+# VLAN's dynamic ranges exist
+resource "maas_vlan_dhcp" "vlan" {
+  for_each = local.vlan_dhcp_map
+
+  fabric                    = maas_vlan.vlan[each.key].fabric
+  vlan                      = maas_vlan.vlan[each.key].vid
+  primary_rack_controller   = each.value.primary_rack != null ? data.maas_rack_controller.rack[each.value.primary_rack].id : null
+  secondary_rack_controller = each.value.secondary_rack != null ? data.maas_rack_controller.rack[each.value.secondary_rack].id : null
+  relay_vlan                = each.value.relay_vlan != null ? maas_vlan.vlan[local.vlan_keys[each.value.relay_vlan]].id : null
+  ip_ranges = [
+    for key, range in maas_subnet_ip_range.ip_range : range.id
+    if local.subnets_map[local.ip_ranges_map[key].subnet_key].vlan_key == each.key && local.ip_ranges_map[key].type == "dynamic"
+  ]
+}
+
+# Static routes between subnets, managed with the MAAS CLI as maas has no
+# static route resource. A route is recreated when any of its fields change.
+resource "null_resource" "static_route" {
+  for_each = local.static_routes_map
+
+  triggers = {
+    source       = try(maas_subnet.subnet[each.value.source_key].id, null)
+    destination  = try(maas_subnet.subnet[each.value.destination_key].id, null)
+    gateway_ip   = each.value.gateway_ip
+    metric       = each.value.metric
+    maas_profile = var.maas_profile
+    maas_api_url = var.maas_api_url
+  }
+
+  lifecycle {
+    precondition {
+      condition     = each.value.source_key != null && each.value.destination_key != null
+      error_message = "Static route ${each.key} must name subnets defined in var.fabrics, by subnet name or \"<fabric>-<vid>-<subnet>\" key."
+    }
+
+    precondition {
+      condition = each.value.source_key == null || (
+        cidrhost("${each.value.gateway_ip}/${split("/", try(local.subnets_map[each.value.source_key].cidr, "0.0.0.0/0"))[1]}", 0) ==
+        cidrhost(try(local.subnets_map[each.value.source_key].cidr, "0.0.0.0/0"), 0)
+      )
+      error_message = "Static route ${each.key} gateway_ip ${each.value.gateway_ip} must be inside its source subnet."
+    }
+  }
+
+  provisioner "local-exec" {
+    command = <<-EOT
+      set -euo pipefail
+
+      # Routes are created in parallel, so each run logs in with its own
+      # profile rather than overwriting a shared one another run is using
+      profile="$MAAS_PROFILE-route-$SOURCE-$DESTINATION-$$"
+      maas login "$profile" "$MAAS_API_URL" "$MAAS_API_KEY" > /dev/null
+      trap 'maas logout "$profile" > /dev/null 2>&1 || true' EXIT
+
+      maas "$profile" static-routes create source="$SOURCE" destination="$DESTINATION" \
+        gateway_ip="$GATEWAY_IP" metric="$METRIC" > /dev/null
+      echo "Added static route from subnet $SOURCE to subnet $DESTINATION via $GATEWAY_IP"
+    EOT
+
+    interpreter = ["bash", "-c"]
+
+    environment = {
+      MAAS_PROFILE = var.maas_profile
+      MAAS_API_URL = var.maas_api_url
+      MAAS_API_KEY = var.maas_api_key
+      SOURCE       = self.triggers.source
+      DESTINATION  = self.triggers.destination
+      GATEWAY_IP   = self.triggers.gateway_ip
+      METRIC       = self.triggers.metric
+    }
+  }
+
+  # Destroy provisioners can only use self, and the API key must not be
+  # stored in triggers, so this logs in again with the key Terraform got as
+  # TF_VAR_maas_api_key (Terragrunt passes its inputs that way)
+  provisioner "local-exec" {
+    when = destroy
+
+    command = <<-EOT
+      set -euo pipefail
+
+      if [ -z "$${TF_VAR_maas_api_key:-}" ]; then
+        echo "TF_VAR_maas_api_key must be set to delete static route $SOURCE -> $DESTINATION" >&2
+        exit 1
+      fi
+      profile="$MAAS_PROFILE-route-$SOURCE-$DESTINATION-$$"
+      maas login "$profile" "$MAAS_API_URL" "$TF_VAR_maas_api_key" > /dev/null
+      trap 'maas logout "$profile" > /dev/null 2>&1 || true' EXIT
+
+      route_id=$(maas "$profile" static-routes read |
+        jq -r --argjson source "$SOURCE" --argjson destination "$DESTINATION" \
+          '.[] | select(.source.id == $source and .destination.id == $destination) | .id')
+      for id in $route_id; do
+        maas "$profile" static-route delete "$id" > /dev/null
+      done
+    EOT
+
+    interpreter = ["bash", "-c"]
+
+    environment = {
+      MAAS_PROFILE = self.triggers.maas_profile
+      MAAS_API_URL = self.triggers.maas_api_url
+      SOURCE       = self.triggers.source
+      DESTINATION  = self.triggers.destination
+    }
+  }
+}
@@ -4,8 +4,9 @@ output "spaces" {
   description = "Map of created spaces"
   value = {
     for k, v in maas_space.space : k => {
-      id   = v.id
-      name = v.name
+      id          = v.id
+      name        = v.name
+      description = var.spaces[k].description
     }
   }
 }
@@ -28,6 +29,7 @@ output "vlans" {
       vid       = v.vid
       name      = v.name
       fabric_id = v.fabric
+      space     = v.space
     }
   }
 }
@@ -36,14 +38,40 @@ output "subnets" {
   description = "Map of created subnets"
   value = {
     for k, v in maas_subnet.subnet : k => {
-      id      = v.id
-      cidr    = v.cidr
-      name    = v.name
-      vlan_id = v.vlan
+      id          = v.id
+      cidr        = v.cidr
+      name        = v.name
+      vlan_id     = v.vlan
+      allow_dns   = v.allow_dns
+      allow_proxy = v.allow_proxy
+      managed     = v.managed
+      ip_version  = local.subnets_map[k].ip_version
+      ipv6_mode   = local.subnets_map[k].ipv6_mode
+    }
+  }
+}
+
+output "subnets_by_name" {
+  description = "Map of subnet names to their ID, CIDR, gateway, fabric, vid, VLAN ID, space and IP version, e.g. for node networking"
+  value = {
+    for k, v in maas_subnet.subnet : local.subnets_map[k].name => {
+      id         = v.id
+      cidr       = v.cidr
+      gateway_ip = v.gateway_ip
+      fabric     = local.vlans_map[local.subnets_map[k].vlan_key].fabric_name
+      vid        = local.vlans_map[local.subnets_map[k].vlan_key].vid
+      vlan_id    = v.vlan
+      space      = local.vlans_map[local.subnets_map[k].vlan_key].space
+      ip_version = local.subnets_map[k].ip_version
     }
   }
 }
 
+output "subnet_ids" {
+  description = "Map of subnet names to subnet IDs, e.g. for the subnet_ids input of maas-configure-nodes-networking"
+  value       = { for k, v in maas_subnet.subnet : local.subnets_map[k].name => v.id }
+}
+
 output "ip_ranges" {
   description = "Map of created IP ranges by subnet"
   value = {
@@ -56,3 +84,41 @@ output "ip_ranges" {
     }
   }
 }
+
+output "ip_ranges_by_subnet" {
+  description = "Map of subnet names to their IP ranges by range name (e.g. metallb), with the subnet CIDR, e.g. for DNS records"
+  value = {
+    for subnet_key, subnet in local.subnets_map : subnet.name => {
+      for range_key, range in local.ip_ranges_map : range.name => {
+        id       = maas_subnet_ip_range.ip_range[range_key].id
+        type     = range.type
+        start_ip = range.start_ip
+        end_ip   = range.end_ip
+        cidr     = subnet.cidr
+      } if range.subnet_key == subnet_key
+    }
+  }
+}
+
+output "vlan_dhcp" {
+  description = "Map of VLANs with rack-served or relayed DHCP to their rack controller system IDs and relay VLAN ID"
+  value = {
+    for k, v in maas_vlan_dhcp.vlan : k => {
+      primary_rack   = v.primary_rack_controller
+      secondary_rack = v.secondary_rack_controller
+      relay_vlan     = v.relay_vlan
+    }
+  }
+}
+
+output "static_routes" {
+  description = "Map of static route names to their source and destination subnet keys, gateway and metric"
+  value = {
+    for k, route in local.static_routes_map : k => {
+      source      = route.source_key
+      destination = route.destination_key
+      gateway_ip  = route.gateway_ip
+      metric      = route.metric
+    }
+  }
+}
@@ -1,5 +1,23 @@
 # MAAS Configure Networking Module Variables
 
+# MAAS API credentials for the CLI calls that set space descriptions
+variable "maas_api_url" {
+  description = "MAAS API URL"
+  type        = string
+}
+
+variable "maas_api_key" {
+  description = "MAAS API key for authentication"
+  type        = string
+  sensitive   = true
+}
+
+variable "maas_profile" {
+  description = "MAAS CLI profile name to use for local-exec provisioners"
+  type        = string
+  default     = "root"
+}
+
 # Spaces configuration
 variable "spaces" {
   description = <<-EOT
@@ -16,30 +34,52 @@ variable "spaces" {
 variable "fabrics" {
   description = <<-EOT
     Map of fabrics with nested VLANs and subnets. Key is the fabric name, value includes:
-    - vlans: List of VLANs in this fabric, each containing:
-      - vid: VLAN ID
-      - space: Space name (optional)
+    - vlans: Map of VLANs in this fabric, keyed by VLAN name (also its name in MAAS) or by vid, each containing:
+      - vid: VLAN ID (optional when the key is the vid, unique within the fabric)
+      - space: Space name (optional, must be a key of spaces)
       - dhcp_on: Enable DHCP (optional, default: false)
       - mtu: MTU value (optional, default: 1500)
-      - subnets: Map of subnets in this VLAN, each containing:
-        - cidr: Subnet CIDR
-        - gateway_ip: Gateway IP (optional)
+      - relay_vlan: VLAN to relay DHCP to, as "<fabric>-<vid>" or "<fabric>-<VLAN key>" (optional)
+      - primary_rack: Hostname of the rack controller serving DHCP (optional)
+      - secondary_rack: Hostname of the standby rack controller (optional, requires primary_rack)
+      - subnets: Map of subnets in this VLAN, keyed by subnet name (unique across fabrics; IPv4 and IPv6 subnets can share a VLAN), each containing:
+        - cidr: Subnet CIDR, IPv4 or IPv6
+        - gateway_ip: Gateway IP, inside the subnet (optional)
         - dns_servers: List of DNS servers (optional)
+        - allow_dns: Allow MAAS DNS resolution from the subnet (optional, default: true)
+        - allow_proxy: Allow access to the MAAS proxy from the subnet (optional, default: true)
+        - rdns_mode: Reverse DNS mode, 0 (disabled), 1 (enabled) or 2 (RFC2317) (optional, default: 2)
+        - managed: Whether MAAS manages IP allocation in the subnet (optional, default: true)
+        - active_discovery: Actively scan the subnet for devices (optional, default: false)
+        - disabled_boot_architectures: Boot architectures to disable, e.g. ["pxe"] (optional, default: [])
+        - ipv6_mode: "slaac" or "dhcpv6", IPv6 subnets only (optional, default: "dhcpv6" if the subnet has a dynamic range, else "slaac").
+          Informational only: MAAS has no per-subnet mode and serves DHCPv6 exactly when the subnet has a dynamic range
+          and its VLAN has dhcp_on, so the mode is only checked against those and reported in the subnets output
         - reserved: Map of IP ranges, each containing:
-          - start_ip: Starting IP
-          - end_ip: Ending IP
+          - start_ip: Starting IP, inside the subnet
+          - end_ip: Ending IP, inside the subnet
           - type: Range type (optional, default: "reserved")
   EOT
   type = map(object({
-    vlans = list(object({
-      vid     = number
-      space   = optional(string)
-      dhcp_on = optional(bool)
-      mtu     = optional(number)
+    vlans = map(object({
+      vid            = optional(number)
+      space          = optional(string)
+      dhcp_on        = optional(bool)
+      mtu            = optional(number)
+      relay_vlan     = optional(string)
+      primary_rack   = optional(string)
+      secondary_rack = optional(string)
       subnets = map(object({
-        cidr        = string
-        gateway_ip  = optional(string)
-        dns_servers = optional(list(string))
+        cidr                        = string
+        gateway_ip                  = optional(string)
+        dns_servers                 = optional(list(string))
+        allow_dns                   = optional(bool, true)
+        allow_proxy                 = optional(bool, true)
+        rdns_mode                   = optional(number, 2)
+        managed                     = optional(bool, true)
+        active_discovery            = optional(bool, false)
+        disabled_boot_architectures = optional(list(string), [])
+        ipv6_mode                   = optional(string)
         reserved = optional(map(object({
           start_ip = string
           end_ip   = string
@@ -49,4 +89,217 @@ variable "fabrics" {
     }))
   }))
   default = {}
+
+  validation {
+    condition = alltrue(flatten([
+      for fabric in values(var.fabrics) : [for key, vlan in fabric.vlans : vlan.vid != null || can(tonumber(key))]
+    ]))
+    error_message = "VLANs keyed by name must set vid."
+  }
+
+  validation {
+    condition = alltrue([
+      for fabric in values(var.fabrics) : length(distinct([
+        for key, vlan in fabric.vlans : vlan.vid != null ? vlan.vid : try(tonumber(key), key)
+      ])) == length(fabric.vlans)
+    ])
+    error_message = "Each vid can only be used once per fabric. Duplicates: ${join(", ", flatten([
+      for name, fabric in var.fabrics : [
+        for vid, vlan_keys in { for key, vlan in fabric.vlans : tostring(vlan.vid != null ? vlan.vid : key) => key... } :
+        "${name} vid ${vid} (${join(", ", vlan_keys)})" if length(vlan_keys) > 1
+      ]
+    ]))}."
+  }
+
+  validation {
+    condition = length(flatten([
+      for fabric in values(var.fabrics) : [for vlan in values(fabric.vlans) : keys(vlan.subnets)]
+      ])) == length(distinct(flatten([
+        for fabric in values(var.fabrics) : [for vlan in values(fabric.vlans) : keys(vlan.subnets)]
+    ])))
+    error_message = "Subnet names must be unique across fabrics. Duplicates: ${join(", ", [
+      for name, vlans in {
+        for item in flatten([
+          for fabric_name, fabric in var.fabrics : [
+            for vlan_key, vlan in fabric.vlans : [for subnet_name in keys(vlan.subnets) : { name = subnet_name, vlan = "${fabric_name}/${vlan_key}" }]
+          ]
+        ]) : item.name => item.vlan...
+      } : "${name} (${join(", ", vlans)})" if length(vlans) > 1
+    ])}."
+  }
+
+  validation {
+    condition = alltrue(flatten([
+      for fabric in values(var.fabrics) : [
+        for vlan in fabric.vlans : [for subnet in values(vlan.subnets) : contains([0, 1, 2], subnet.rdns_mode)]
+      ]
+    ]))
+    error_message = "Subnet rdns_mode must be 0 (disabled), 1 (enabled) or 2 (RFC2317)."
+  }
+
+  validation {
+    condition = alltrue(flatten([
+      for fabric in values(var.fabrics) : [
+        for vlan in fabric.vlans : [
+          for subnet in values(vlan.subnets) : [
+            for ip in concat(
+              subnet.gateway_ip == null ? [] : [subnet.gateway_ip],
+              flatten([for range in values(subnet.reserved == null ? {} : subnet.reserved) : [range.start_ip, range.end_ip]])
+            ) : can(cidrhost(subnet.cidr, 0)) && try(cidrhost("${ip}/${split("/", subnet.cidr)[1]}", 0) == cidrhost(subnet.cidr, 0), false)
+          ]
+        ]
+      ]
+    ]))
+    error_message = "Subnet cidr must be a valid IPv4 or IPv6 CIDR, and gateway_ip and reserved range start_ip/end_ip must be addresses inside it."
+  }
+
+  validation {
+    condition = alltrue(flatten([
+      for fabric in values(var.fabrics) : [
+        for vlan in fabric.vlans : [
+          for subnet in values(vlan.subnets) : [
+            for range in values(subnet.reserved == null ? {} : subnet.reserved) : range.type == null || contains(["reserved", "dynamic"], coalesce(range.type, "-"))
+          ]
+        ]
+      ]
+    ]))
+    error_message = "Reserved range type must be \"reserved\" or \"dynamic\"."
+  }
+
+  # Addresses are compared as numbers: IPv4 from its octets, IPv6 from its
+  # hextets ("::" expanded) as one 32-digit hex number, since pow() would lose
+  # precision above 2^53
+  validation {
+    condition = alltrue(flatten([
+      for fabric in values(var.fabrics) : [
+        for vlan in fabric.vlans : [
+          for subnet in values(vlan.subnets) : [
+            for reserved in [subnet.reserved == null ? {} : subnet.reserved] : try([
+              for address in [{
+                for ip in distinct(concat(
+                  subnet.gateway_ip == null ? [] : [subnet.gateway_ip],
+                  flatten([for range in values(reserved) : [range.start_ip, range.end_ip]])
+                  )) : ip => (can(regex(":", ip)) ? parseint(join("", [
+                    for hextet in concat(
+                      compact(split(":", split("::", ip)[0])),
+                      [for zero in range(8 - length(compact(split(":", ip)))) : "0"],
+                      length(split("::", ip)) > 1 ? compact(split(":", split("::", ip)[1])) : []
+                    ) : substr("0000${hextet}", length(hextet), 4)
+                ]), 16) : sum([for i, octet in split(".", ip) : tonumber(octet) * pow(256, 3 - i)]))
+                }] : concat(
+                # Ranges run forwards
+                [for range in values(reserved) : address[range.start_ip] <= address[range.end_ip]],
+                # Ranges do not overlap
+                [
+                  for pair in setproduct(keys(reserved), keys(reserved)) : pair[0] == pair[1] ||
+                  address[reserved[pair[0]].end_ip] < address[reserved[pair[1]].start_ip] ||
+                  address[reserved[pair[1]].end_ip] < address[reserved[pair[0]].start_ip]
+                ],
+                # Dynamic ranges do not hand out the gateway
+                [
+                  for range in values(reserved) : range.type != "dynamic" ||
+                  lookup(address, coalesce(subnet.gateway_ip, "-"), -1) < address[range.start_ip] ||
+                  lookup(address, coalesce(subnet.gateway_ip, "-"), -1) > address[range.end_ip]
+                ]
+              )
+            ], [false])
+          ]
+        ]
+      ]
+    ]))
+    error_message = "Reserved ranges in a subnet must have start_ip <= end_ip and must not overlap, and dynamic ranges must not include the subnet's gateway_ip."
+  }
+
+  validation {
+    condition = alltrue(flatten([
+      for fabric in values(var.fabrics) : [
+        for vlan in fabric.vlans : [
+          for subnet in values(vlan.subnets) : subnet.ipv6_mode == null || (
+            contains(["slaac", "dhcpv6"], coalesce(subnet.ipv6_mode, "-")) && can(regex(":", subnet.cidr))
+          )
+        ]
+      ]
+    ]))
+    error_message = "Subnet ipv6_mode must be \"slaac\" or \"dhcpv6\", and is only valid on IPv6 subnets."
+  }
+
+  validation {
+    condition = alltrue(flatten([
+      for fabric in values(var.fabrics) : [
+        for vlan in fabric.vlans : [
+          for subnet in values(vlan.subnets) : (
+            contains([for range in values(subnet.reserved == null ? {} : subnet.reserved) : range.type], "dynamic")
+            ? subnet.ipv6_mode != "slaac"
+            : subnet.ipv6_mode != "dhcpv6"
+          ) && (subnet.ipv6_mode != "dhcpv6" || vlan.dhcp_on == true)
+        ]
+      ]
+    ]))
+    error_message = "dhcpv6 subnets need a dynamic range and dhcp_on on their VLAN; slaac subnets must not have a dynamic range."
+  }
+
+  validation {
+    condition = alltrue(flatten([
+      for fabric in values(var.fabrics) : [
+        for vlan in fabric.vlans : anytrue(flatten([
+          for subnet in values(vlan.subnets) : [
+            for range in values(subnet.reserved == null ? {} : subnet.reserved) : range.type == "dynamic"
+          ]
+        ])) if vlan.dhcp_on == true
+      ]
+    ]))
+    error_message = "VLANs with dhcp_on must have a reserved range of type \"dynamic\" in one of their subnets."
+  }
+
+  validation {
+    condition = alltrue(flatten([
+      for fabric in values(var.fabrics) : [
+        for vlan in fabric.vlans : (vlan.relay_vlan == null || (vlan.primary_rack == null && vlan.dhcp_on != true)) && (vlan.primary_rack == null || vlan.dhcp_on == true) && (vlan.secondary_rack == null || vlan.primary_rack != null)
+      ]
+    ]))
+    error_message = "A VLAN either relays DHCP (relay_vlan, without dhcp_on or racks) or serves it (dhcp_on, optionally with primary_rack); secondary_rack requires primary_rack."
+  }
+
+  validation {
+    condition = alltrue(flatten([
+      for fabric in values(var.fabrics) : [
+        for vlan in fabric.vlans : contains(flatten([
+          for name, f in var.fabrics : [
+            for key, v in f.vlans : ["${name}-${v.vid != null ? v.vid : key}", "${name}-${key}"] if v.dhcp_on == true
+          ]
+        ]), vlan.relay_vlan) if vlan.relay_vlan != null
+      ]
+    ]))
+    error_message = "relay_vlan must be \"<fabric>-<vid>\" or \"<fabric>-<VLAN key>\" of a VLAN in fabrics with dhcp_on."
+  }
+}
+
+# Static routes between subnets
+variable "static_routes" {
+  description = <<-EOT
+    Map of static routes to create, keyed by route name. Each route contains:
+    - source: Subnet the route is added to, by subnet name or "<fabric>-<vid>-<subnet>" key
+    - destination: Subnet the route reaches, by subnet name or "<fabric>-<vid>-<subnet>" key
+    - gateway_ip: Next hop, inside the source subnet
+    - metric: Route metric (optional, default: 0)
+  EOT
+  type = map(object({
+    source      = string
+    destination = string
+    gateway_ip  = string
+    metric      = optional(number, 0)
+  }))
+  default = {}
+
+  validation {
+    condition     = alltrue([for route in values(var.static_routes) : route.source != route.destination])
+    error_message = "A static route's source and destination must be different subnets."
+  }
+
+  validation {
+    condition = alltrue([
+      for route in values(var.static_routes) : can(cidrhost("${route.gateway_ip}/${can(regex(":", route.gateway_ip)) ? 128 : 32}", 0)) && route.metric >= 0
+    ])
+    error_message = "Static route gateway_ip must be an IPv4 or IPv6 address and metric must not be negative."
+  }
 }
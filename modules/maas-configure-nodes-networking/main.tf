@@ -1,8 +1,21 @@
+# Wait until every node is in wait_for_state before looking it up
+module "machines_ready" {
+  source = "../maas-wait-for-machines"
+  count  = var.wait_for_state != null ? 1 : 0
+
+  machines     = keys(var.nodes)
+  target_state = var.wait_for_state
+  timeout      = var.wait_timeout
+  wait_command = var.wait_command
+}
+
 # Data source to lookup machine system IDs by hostname
 # The map key is used as the machine hostname
 data "maas_machine" "machines" {
   for_each = var.nodes
   hostname = each.key
+
+  depends_on = [module.machines_ready]
 }
 
 locals {
@@ -316,7 +329,7 @@ resource "maas_network_interface_link" "link" {
 
   machine           = each.value.machine_id
   network_interface = each.value.network_interface
-  subnet            = each.value.subnet_id
+  subnet            = lookup(var.subnet_ids, each.value.subnet_id, each.value.subnet_id)
   mode              = each.value.mode
   ip_address        = try(each.value.ip_address, null)
   default_gateway   = each.value.default_gateway
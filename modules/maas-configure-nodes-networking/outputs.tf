@@ -65,6 +65,18 @@ output "interface_links" {
   }
 }
 
+output "static_ip_addresses" {
+  description = "Map of node hostnames to the static IP addresses of their STATIC links, with each address's subnet_id, e.g. for DNS records"
+  value = {
+    for node_key, node in local.merged_nodes : node_key => [
+      for link in values(node.interface_links) : {
+        ip_address = link.ip_address
+        subnet_id  = link.subnet_id
+      } if link.mode == "STATIC" && try(link.ip_address, null) != null
+    ]
+  }
+}
+
 output "nodes_summary" {
   description = "Summary of configured nodes"
   value = {
@@ -1,3 +1,6 @@
+# The maas provider is configured by the caller (the unit generates
+# maas_provider.tf), so that this module can also be called from
+# maas-compose-vms with depends_on
 variable "maas_api_url" {
   description = "MAAS API URL"
   type        = string
@@ -8,8 +11,3 @@ variable "maas_api_key" {
   type        = string
   sensitive   = true
 }
-
-provider "maas" {
-  api_url = var.maas_api_url
-  api_key = var.maas_api_key
-}
@@ -141,6 +141,28 @@ variable "nodes" {
     ])
     error_message = "ip_address is required when mode is STATIC"
   }
+
+  validation {
+    condition = alltrue(flatten([
+      for node_key, node in var.nodes : [
+        for ip in concat(
+          [for ip_config in values(node.static_ip_addresses) : { ip_address = ip_config.ip_address, subnet = ip_config.subnet_id }],
+          [for link in values(node.interface_links) : { ip_address = link.ip_address, subnet = link.subnet_id } if link.ip_address != null]
+        ) :
+        can(cidrhost("${ip.ip_address}/${can(regex(":", ip.ip_address)) ? 128 : 32}", 0)) && (
+          # Subnets given as a CIDR rather than an ID must contain the address
+          !can(cidrhost(ip.subnet, 0)) || try(cidrhost("${ip.ip_address}/${split("/", ip.subnet)[1]}", 0) == cidrhost(ip.subnet, 0), false)
+        )
+      ]
+    ]))
+    error_message = "Static ip_address values must be IPv4 or IPv6 addresses, inside their subnet when subnet_id is a CIDR"
+  }
+}
+
+variable "subnet_ids" {
+  description = "Map of subnet names to subnet IDs (e.g. the subnet_ids output of maas-configure-networking); subnet_id values found here are replaced by their ID"
+  type        = map(string)
+  default     = {}
 }
 
 variable "maas_profile" {
@@ -148,3 +170,22 @@ variable "maas_profile" {
   type        = string
   default     = "root"
 }
+
+# Readiness gate: wait for the machines before configuring them
+variable "wait_for_state" {
+  description = "State machines must reach before they are configured (Ready, Allocated or Deployed); null disables the gate"
+  type        = string
+  default     = null
+}
+
+variable "wait_timeout" {
+  description = "How long to wait for machines to reach wait_for_state, as a Go duration (e.g. 30m)"
+  type        = string
+  default     = "30m"
+}
+
+variable "wait_command" {
+  description = "Command running the maas-wait tool (see tools/cmd/maas-wait)"
+  type        = list(string)
+  default     = ["maas-wait"]
+}
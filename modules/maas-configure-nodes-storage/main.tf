@@ -146,10 +146,23 @@ locals {
   ])
 }
 
+# Wait until every node is in wait_for_state before looking it up
+module "machines_ready" {
+  source = "../maas-wait-for-machines"
+  count  = var.wait_for_state != null ? 1 : 0
+
+  machines     = [for node in var.nodes : node.hostname]
+  target_state = var.wait_for_state
+  timeout      = var.wait_timeout
+  wait_command = var.wait_command
+}
+
 # Data source to look up machines by hostname
 data "maas_machine" "machines" {
   for_each = var.nodes
   hostname = each.value.hostname
+
+  depends_on = [module.machines_ready]
 }
 
 # Configure block devices
@@ -127,3 +127,22 @@ variable "nodes" {
     })), {})
   }))
 }
+
+# Readiness gate: wait for the machines before configuring them
+variable "wait_for_state" {
+  description = "State machines must reach before they are configured (Ready, Allocated or Deployed); null disables the gate"
+  type        = string
+  default     = null
+}
+
+variable "wait_timeout" {
+  description = "How long to wait for machines to reach wait_for_state, as a Go duration (e.g. 30m)"
+  type        = string
+  default     = "30m"
+}
+
+variable "wait_command" {
+  description = "Command running the maas-wait tool (see tools/cmd/maas-wait)"
+  type        = list(string)
+  default     = ["maas-wait"]
+}
@@ -0,0 +1,95 @@
+# MAAS DNS Module
+# Manages MAAS DNS A/AAAA/CNAME/SRV/TXT records in domains created by
+# maas-config, including records derived from node static IPs and from
+# reserved ranges such as metallb
+
+locals {
+  # A/AAAA records for node static IPs, named after the node's short hostname
+  node_records = merge(flatten([
+    for set_name, set in var.node_records : [
+      for node, addresses in var.node_static_ip_addresses : {
+        for address in addresses : "${set_name}/${node}/${address.ip_address}" => {
+          domain  = set.domain
+          name    = "${split(".", node)[0]}${set.suffix}"
+          type    = can(regex(":", address.ip_address)) ? "AAAA" : "A"
+          data    = address.ip_address
+          ttl     = set.ttl
+          problem = null
+        } if contains(set.subnets != null ? set.subnets : [address.subnet_id], address.subnet_id)
+      }
+    ]
+  ])...)
+
+  # Start, end and network address of the range each range record set names
+  range_addresses = {
+    for set_name, set in var.range_records : set_name => try({
+      start   = var.ip_ranges_by_subnet[set.subnet][set.range].start_ip
+      end     = var.ip_ranges_by_subnet[set.subnet][set.range].end_ip
+      network = cidrhost(var.ip_ranges_by_subnet[set.subnet][set.range].cidr, 0)
+      cidr    = var.ip_ranges_by_subnet[set.subnet][set.range].cidr
+    }, null)
+  }
+
+  # The same addresses as numbers (IPv6 converted from 32 hex digits), so
+  # names map to start_ip + index
+  range_bounds = {
+    for set_name, addresses in local.range_addresses : set_name => {
+      for bound in ["start", "end", "network"] : bound => can(regex(":", addresses[bound])) ? parseint(join("", [
+        for hextet in concat(
+          compact(split(":", split("::", addresses[bound])[0])),
+          [for zero in range(8 - length(compact(split(":", addresses[bound])))) : "0"],
+          length(split("::", addresses[bound])) > 1 ? compact(split(":", split("::", addresses[bound])[1])) : []
+        ) : substr("0000${hextet}", length(hextet), 4)
+      ]), 16) : parseint(join("", [for octet in split(".", addresses[bound]) : format("%02x", tonumber(octet))]), 16)
+    } if addresses != null
+  }
+
+  # A/AAAA records for the addresses of reserved ranges, one name per address
+  # ("" skips an address)
+  range_records = merge([
+    for set_name, set in var.range_records : {
+      for index, name in set.names : "${set_name}/${name}" => {
+        domain = set.domain
+        name   = name
+        type   = can(regex(":", try(local.range_addresses[set_name].cidr, ""))) ? "AAAA" : "A"
+        data = try(cidrhost(
+          local.range_addresses[set_name].cidr,
+          local.range_bounds[set_name].start - local.range_bounds[set_name].network + index
+        ), null)
+        ttl = set.ttl
+        problem = (
+          local.range_addresses[set_name] == null ? "range ${set.range} of subnet ${set.subnet} is not in ip_ranges_by_subnet" :
+          try(local.range_bounds[set_name].start + index > local.range_bounds[set_name].end, false) ? "range ${set.range} of subnet ${set.subnet} has fewer addresses than names" : null
+        )
+      } if name != ""
+    }
+  ]...)
+
+  records = merge(
+    { for key, record in var.records : key => merge(record, { problem = null }) },
+    local.node_records,
+    local.range_records
+  )
+}
+
+resource "maas_dns_record" "record" {
+  for_each = local.records
+
+  type   = each.value.type
+  name   = each.value.name
+  domain = each.value.domain
+  data   = each.value.data
+  ttl    = each.value.ttl
+
+  lifecycle {
+    precondition {
+      condition     = each.value.problem == null
+      error_message = "DNS record ${each.key}: ${coalesce(each.value.problem, "invalid")}."
+    }
+
+    precondition {
+      condition     = contains(concat(keys(var.domains), var.existing_domains), each.value.domain)
+      error_message = "DNS record ${each.key}: domain ${each.value.domain} is not in domains or existing_domains; add it to maas-config."
+    }
+  }
+}
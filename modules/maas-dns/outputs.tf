@@ -0,0 +1,18 @@
+# MAAS DNS Module Outputs
+
+output "records" {
+  description = "Map of DNS record keys (\"<set>/<node>/<address>\" and \"<set>/<name>\" for derived records) to their FQDN, type and data"
+  value = {
+    for k, v in maas_dns_record.record : k => {
+      id   = v.id
+      fqdn = "${v.name}.${v.domain}"
+      type = v.type
+      data = v.data
+    }
+  }
+}
+
+output "fqdns" {
+  description = "Map of DNS record FQDNs to the addresses or data they resolve to"
+  value       = { for v in maas_dns_record.record : "${v.name}.${v.domain}" => v.data... }
+}
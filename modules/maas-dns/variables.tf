@@ -0,0 +1,130 @@
+# MAAS DNS Module Variables
+
+# Domains are created by maas-config; records name them
+variable "domains" {
+  description = "Map of DNS domain names to IDs, e.g. the domains output of maas-config"
+  type        = map(string)
+  default     = {}
+}
+
+variable "existing_domains" {
+  description = "Domains records can use that exist in MAAS without being in domains, e.g. the built-in maas domain"
+  type        = list(string)
+  default     = ["maas"]
+}
+
+variable "records" {
+  description = <<-EOT
+    Map of DNS records, keyed by any unique name, each containing:
+    - domain: Domain of the record, in domains or existing_domains
+    - name: Record name within the domain, e.g. "sunbeam" or "_ldap._tcp" for SRV records
+    - type: A, AAAA, CNAME, SRV or TXT
+    - data: IPv4 address (A), IPv6 address (AAAA), target hostname (CNAME), "<priority> <weight> <port> <target>" (SRV) or text (TXT)
+    - ttl: TTL in seconds (optional, the domain's TTL)
+  EOT
+  type = map(object({
+    domain = string
+    name   = string
+    type   = string
+    data   = string
+    ttl    = optional(number)
+  }))
+  default = {}
+
+  validation {
+    condition     = alltrue([for record in values(var.records) : contains(["A", "AAAA", "CNAME", "SRV", "TXT"], record.type)])
+    error_message = "Record type must be one of: A, AAAA, CNAME, SRV, TXT."
+  }
+
+  validation {
+    condition = alltrue([
+      for record in values(var.records) : record.type == "A" ? !can(regex(":", record.data)) && can(cidrhost("${record.data}/32", 0)) : record.type == "AAAA" ? can(regex(":", record.data)) && can(cidrhost("${record.data}/128", 0)) : true
+    ])
+    error_message = "A records need an IPv4 address and AAAA records an IPv6 address as data."
+  }
+
+  validation {
+    condition = alltrue([
+      for record in values(var.records) : record.type != "SRV" || (
+        substr(record.name, 0, 1) == "_" && can(regex("^\\d+ \\d+ \\d+ \\S+$", record.data))
+      )
+    ])
+    error_message = "SRV records need a name like \"_service._proto\" and data \"<priority> <weight> <port> <target>\"."
+  }
+}
+
+# Records derived from the static IPs of nodes
+variable "node_static_ip_addresses" {
+  description = "Map of node hostnames to their static addresses and subnets, e.g. the static_ip_addresses output of maas-configure-nodes-networking"
+  type = map(list(object({
+    ip_address = string
+    subnet_id  = string
+  })))
+  default = {}
+}
+
+variable "node_records" {
+  description = <<-EOT
+    Sets of A/AAAA records for the static IPs in node_static_ip_addresses, keyed by any unique name, each containing:
+    - domain: Domain of the records
+    - subnets: Only addresses whose subnet_id is in this list, e.g. ["oam"] (optional, default: all)
+    - suffix: Appended to each node's short hostname to form the record name, e.g. "-storage" (optional, default: "")
+    - ttl: TTL in seconds (optional)
+  EOT
+  type = map(object({
+    domain  = string
+    subnets = optional(list(string))
+    suffix  = optional(string, "")
+    ttl     = optional(number)
+  }))
+  default = {}
+}
+
+# Records derived from reserved ranges of the networking tfvars
+variable "ip_ranges_by_subnet" {
+  description = "Map of subnet names to their IP ranges by range name, e.g. the ip_ranges_by_subnet output of maas-configure-networking"
+  type = map(map(object({
+    start_ip = string
+    end_ip   = string
+    cidr     = string
+  })))
+  default = {}
+}
+
+variable "range_records" {
+  description = <<-EOT
+    Sets of A/AAAA records for the addresses of a reserved range in ip_ranges_by_subnet, keyed by any unique name, each containing:
+    - subnet: Subnet name, e.g. "oam"
+    - range: Range name within the subnet, e.g. "metallb"
+    - domain: Domain of the records
+    - names: Record names, given the range's addresses in order from start_ip ("" skips an address)
+    - ttl: TTL in seconds (optional)
+  EOT
+  type = map(object({
+    subnet = string
+    range  = string
+    domain = string
+    names  = list(string)
+    ttl    = optional(number)
+  }))
+  default = {}
+
+  validation {
+    condition = alltrue([
+      for set in values(var.range_records) : length(compact(set.names)) == length(distinct(compact(set.names)))
+    ])
+    error_message = "Range record names must be unique within a set."
+  }
+}
+
+# MAAS API credentials
+variable "maas_api_url" {
+  description = "MAAS API URL"
+  type        = string
+}
+
+variable "maas_api_key" {
+  description = "MAAS API key for authentication"
+  type        = string
+  sensitive   = true
+}
@@ -2,23 +2,122 @@
 # Wraps the canonical/maas provider machine resource
 # Reference: https://registry.terraform.io/providers/canonical/maas/latest/docs/resources/machine
 
+locals {
+  # Resolve power_credentials references against bmc_credentials, falling back
+  # to inline power_user/power_pass
+  power_credentials = {
+    for name, machine in var.machines : name => try(var.bmc_credentials[machine.power_credentials], {
+      power_user = machine.power_user
+      power_pass = machine.power_pass
+      revision   = null
+    })
+  }
+
+  # Credential revisions are not secret, strip the sensitivity so they can be used as triggers
+  credential_revisions = nonsensitive({
+    for name, credentials in var.bmc_credentials : name => credentials.revision
+  })
+
+  # Build the power parameters JSON per machine
+  power_parameters = {
+    for name, machine in var.machines : name => jsonencode({
+      power_address   = machine.power_address
+      power_user      = local.power_credentials[name].power_user
+      power_pass      = local.power_credentials[name].power_pass
+      power_driver    = machine.power_driver
+      power_boot_type = machine.power_boot_type
+      cipher_suite_id = machine.cipher_suite_id
+    })
+  }
+
+  # Machine keys by the zone and pool they are enlisted into, grouped on the
+  # inputs so the outputs are known at plan time. MAAS puts machines without
+  # a zone or pool into "default"
+  machines_by_zone = {
+    for name, machine in var.machines : coalesce(machine.zone, "default") => name...
+  }
+  machines_by_pool = {
+    for name, machine in var.machines : coalesce(machine.pool, "default") => name...
+  }
+}
+
 resource "maas_machine" "machine" {
+  for_each = var.machines
+
   # Power configuration
-  power_type       = var.power_type
-  power_parameters = var.power_parameters
+  power_type       = each.value.power_type
+  power_parameters = local.power_parameters[each.key]
 
-  # PXE boot configuration (optional)
-  pxe_mac_address = var.pxe_mac_address
+  # PXE boot configuration
+  pxe_mac_address = each.value.pxe_mac_address
 
-  # Machine configuration
-  hostname     = var.hostname
-  zone         = var.zone
-  architecture = var.architecture
+  # Machine configuration, the map key is the default hostname
+  hostname     = coalesce(each.value.hostname, each.key)
+  zone         = each.value.zone
+  pool         = each.value.pool
+  architecture = each.value.architecture
 
   # Prevent power_parameters from being displayed in diffs
+  # Rotated credentials are pushed by null_resource.push_power_parameters instead
   lifecycle {
     ignore_changes = [
       power_parameters
     ]
+
+    precondition {
+      condition     = each.value.power_credentials == null ? true : contains(nonsensitive(keys(var.bmc_credentials)), each.value.power_credentials)
+      error_message = "Machine ${each.key} references power_credentials that are not defined in bmc_credentials."
+    }
+  }
+}
+
+# Push rotated power credentials to MAAS without recreating the machines
+# Only runs when enabled and a machine's credential revision changes
+resource "null_resource" "push_power_parameters" {
+  for_each = var.push_power_parameters ? var.machines : {}
+
+  triggers = {
+    machine_id = maas_machine.machine[each.key].id
+    revision   = try(local.credential_revisions[each.value.power_credentials], null)
+  }
+
+  provisioner "local-exec" {
+    command = <<-EOT
+      set -euo pipefail
+
+      # Machines are updated in parallel, so each run logs in with its own
+      # profile rather than overwriting a shared one another run is using
+      profile="$MAAS_PROFILE-power-$MACHINE_ID-$$"
+      maas login "$profile" "$MAAS_API_URL" "$MAAS_API_KEY" > /dev/null
+      trap 'maas logout "$profile" > /dev/null 2>&1 || true' EXIT
+
+      # Convert the power parameters JSON into power_parameters_<key>=<value> arguments
+      args=()
+      while IFS= read -r param; do
+        args+=("power_parameters_$param")
+      done < <(jq -r 'to_entries[] | select(.value != null) | "\(.key)=\(.value)"' <<< "$POWER_PARAMETERS")
+
+      maas "$profile" machine update "$MACHINE_ID" power_type="$POWER_TYPE" "$${args[@]}" > /dev/null
+      echo "Pushed power parameters (revision $REVISION) to $MACHINE_ID"
+    EOT
+
+    interpreter = ["bash", "-c"]
+
+    environment = {
+      MAAS_PROFILE     = var.maas_profile
+      MAAS_API_URL     = var.maas_api_url
+      MAAS_API_KEY     = var.maas_api_key
+      MACHINE_ID       = maas_machine.machine[each.key].id
+      POWER_TYPE       = each.value.power_type
+      POWER_PARAMETERS = local.power_parameters[each.key]
+      REVISION         = coalesce(try(local.credential_revisions[each.value.power_credentials], null), "unset")
+    }
+  }
+
+  lifecycle {
+    precondition {
+      condition     = var.maas_api_url != null && var.maas_api_key != null
+      error_message = "maas_api_url and maas_api_key are required when push_power_parameters is true."
+    }
   }
 }
@@ -1,26 +1,47 @@
-# MAAS Machine Module Outputs
+# MAAS Enlist Machines Module Outputs
 
-output "id" {
-  description = "The MAAS machine system ID"
-  value       = maas_machine.machine.id
+output "machines" {
+  description = "Map of enlisted machines with their details, keyed by the machines map key"
+  value = {
+    for k, m in maas_machine.machine : k => {
+      id         = m.id
+      hostname   = m.hostname
+      zone       = m.zone
+      pool       = m.pool
+      power_type = m.power_type
+    }
+  }
 }
 
-output "hostname" {
-  description = "The hostname of the machine"
-  value       = maas_machine.machine.hostname
+output "machine_ids" {
+  description = "Map of machine keys to their MAAS system IDs"
+  value       = { for k, m in maas_machine.machine : k => m.id }
 }
 
-output "zone" {
-  description = "The availability zone of the machine"
-  value       = maas_machine.machine.zone
+output "hostnames" {
+  description = "List of all enlisted machine hostnames"
+  value       = [for m in maas_machine.machine : m.hostname]
 }
 
-output "pool" {
-  description = "The resource pool of the machine"
-  value       = maas_machine.machine.pool
+output "machines_by_zone" {
+  description = "Map of availability zones to the machine keys and system IDs in each zone"
+  value = {
+    for zone, names in local.machines_by_zone : zone => {
+      for name in names : name => maas_machine.machine[name].id
+    }
+  }
 }
 
-output "power_type" {
-  description = "The power type configured for the machine"
-  value       = maas_machine.machine.power_type
+output "machines_by_pool" {
+  description = "Map of resource pools to the machine keys and system IDs in each pool"
+  value = {
+    for pool, names in local.machines_by_pool : pool => {
+      for name in names : name => maas_machine.machine[name].id
+    }
+  }
+}
+
+output "power_credentials" {
+  description = "Map of machine keys to the BMC credentials entry they use"
+  value       = { for k, m in var.machines : k => m.power_credentials }
 }
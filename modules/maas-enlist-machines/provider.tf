@@ -4,5 +4,9 @@ terraform {
       source  = "canonical/maas"
       version = "~> 2.6.0"
     }
+    null = {
+      source  = "hashicorp/null"
+      version = "~> 3.2"
+    }
   }
 }
@@ -1,36 +1,84 @@
-# MAAS Machine Module Variables
+# MAAS Enlist Machines Module Variables
 
-variable "power_type" {
-  description = "The power type of the machine (e.g., 'manual', 'ipmi', 'virsh', 'lxd', etc.)"
-  type        = string
+# Machine Definitions
+variable "machines" {
+  description = <<-EOT
+    Map of machines to enlist. Key is the hostname, value is machine configuration.
+    Each machine configuration includes:
+    - power_type: Power type (ipmi, virsh, manual, etc.)
+    - power_address: Power management address/URL
+    - power_credentials: Name of an entry in bmc_credentials holding power_user/power_pass (optional)
+    - power_user: Power management username (optional, prefer power_credentials)
+    - power_pass: Power management password (optional, prefer power_credentials)
+    - power_driver: Power driver type, e.g., LAN_2_0 for IPMI (optional)
+    - power_boot_type: Boot type for power management (e.g., 'efi', 'legacy') (optional)
+    - cipher_suite_id: Cipher suite ID for power management (optional)
+    - pxe_mac_address: MAC address for PXE boot
+    - hostname: Hostname for the machine (optional, defaults to map key)
+    - zone: Availability zone (optional, MAAS uses "default")
+    - architecture: Machine architecture, default 'amd64/generic' (optional)
+    - pool: Resource pool (optional, MAAS uses "default")
+  EOT
+  type = map(object({
+    power_type        = string
+    power_address     = string
+    power_credentials = optional(string)
+    power_user        = optional(string)
+    power_pass        = optional(string)
+    power_driver      = optional(string)
+    power_boot_type   = optional(string)
+    cipher_suite_id   = optional(number)
+    pxe_mac_address   = string
+    hostname          = optional(string)
+    zone              = optional(string)
+    architecture      = optional(string, "amd64/generic")
+    pool              = optional(string)
+  }))
+  default = {}
 }
 
-variable "power_parameters" {
-  description = "Power parameters specific to the power type as a JSON string"
-  type        = string
-  sensitive   = true
+# BMC Credentials
+variable "bmc_credentials" {
+  description = <<-EOT
+    Map of named BMC credentials referenced by machines[*].power_credentials.
+    Keep these out of machines.tfvars; the terragrunt unit loads them from
+    bmc-credentials.json or the BMC_CREDENTIALS_JSON environment variable.
+    Each entry includes:
+    - power_user: Power management username
+    - power_pass: Power management password
+    - revision: Revision of the credentials, bump it after a rotation (optional)
+  EOT
+  type = map(object({
+    power_user = string
+    power_pass = string
+    revision   = optional(string)
+  }))
+  default   = {}
+  sensitive = true
 }
 
-variable "pxe_mac_address" {
-  description = "The MAC address of the machine's PXE boot interface (optional if machine already exists in MAAS)"
-  type        = string
-  default     = null
+variable "push_power_parameters" {
+  description = "Push power parameters to MAAS when a machine's credential revision changes (power_parameters changes are otherwise ignored)"
+  type        = bool
+  default     = false
 }
 
-variable "hostname" {
-  description = "The hostname to assign to the machine"
+# MAAS API credentials, used by the provider and by the MAAS CLI when pushing power parameters
+variable "maas_api_url" {
+  description = "MAAS API URL"
   type        = string
   default     = null
 }
 
-variable "zone" {
-  description = "The availability zone to assign the machine to"
+variable "maas_api_key" {
+  description = "MAAS API key for authentication"
   type        = string
   default     = null
+  sensitive   = true
 }
 
-variable "architecture" {
-  description = "The architecture of the machine (e.g., 'amd64/generic', 'arm64/generic')"
+variable "maas_profile" {
+  description = "MAAS CLI profile name to use for local-exec provisioners"
   type        = string
-  default     = "amd64/generic"
+  default     = "root"
 }
@@ -0,0 +1,107 @@
+# MAAS VM Hosts Module
+# Registers LXD (standalone or clustered) and virsh VM hosts with MAAS so that
+# maas-compose-vms can compose VMs on them by name
+
+locals {
+  # Cluster members MAAS registers alongside the endpoint added here, keyed by
+  # member name
+  cluster_members = merge([
+    for name, host in var.vm_hosts : {
+      for member in host.cluster_members : member => merge(host, { cluster_host = name })
+    }
+  ]...)
+
+  # Settings maas_vm_host does not manage, applied with `maas vm-host update`.
+  # Cluster members get every setting of the host they were registered through.
+  host_updates = merge(
+    {
+      for name, host in var.vm_hosts : name => {
+        default_storage_pool = host.default_storage_pool
+      } if host.default_storage_pool != null
+    },
+    {
+      for member, host in local.cluster_members : member => {
+        zone                     = host.zone
+        pool                     = host.pool
+        tags                     = length(host.tags) > 0 ? join(",", host.tags) : null
+        cpu_over_commit_ratio    = tostring(host.cpu_over_commit_ratio)
+        memory_over_commit_ratio = tostring(host.memory_over_commit_ratio)
+        default_storage_pool     = host.default_storage_pool
+        default_macvlan_mode     = host.default_macvlan_mode
+      }
+    }
+  )
+}
+
+resource "maas_vm_host" "vm_host" {
+  for_each = var.vm_hosts
+
+  name    = each.key
+  type    = each.value.type
+  machine = each.value.machine
+
+  power_address = each.value.power_address
+  power_user    = each.value.power_user
+  power_pass    = try(var.vm_host_credentials[each.key].power_pass, null)
+  certificate   = try(var.vm_host_credentials[each.key].certificate, null)
+  key           = try(var.vm_host_credentials[each.key].key, null)
+  project       = each.value.project
+
+  zone = each.value.zone
+  pool = each.value.pool
+  tags = each.value.tags
+
+  cpu_over_commit_ratio    = each.value.cpu_over_commit_ratio
+  memory_over_commit_ratio = each.value.memory_over_commit_ratio
+  default_macvlan_mode     = each.value.default_macvlan_mode
+}
+
+# The other members of a clustered LXD, discovered by MAAS when the first
+# member is registered
+data "maas_vm_host" "cluster_member" {
+  for_each = local.cluster_members
+
+  name = each.key
+
+  depends_on = [maas_vm_host.vm_host]
+}
+
+locals {
+  vm_host_ids = merge(
+    { for name, host in maas_vm_host.vm_host : name => host.id },
+    { for member, host in data.maas_vm_host.cluster_member : member => host.id }
+  )
+}
+
+# Apply the default storage pool, and the settings of cluster members
+# Re-runs when the VM host or any of its settings change
+resource "null_resource" "vm_host_update" {
+  for_each = local.host_updates
+
+  triggers = merge(
+    { vm_host_id = local.vm_host_ids[each.key] },
+    { for key, value in each.value : key => value if value != null }
+  )
+
+  provisioner "local-exec" {
+    command     = <<-EOT
+      set -euo pipefail
+      # VM hosts are updated in parallel, so each run logs in with its own
+      # profile rather than overwriting a shared one another run is using
+      profile="$MAAS_PROFILE-vm-host-$VM_HOST_ID-$$"
+      maas login "$profile" "$MAAS_API_URL" "$MAAS_API_KEY" > /dev/null
+      trap 'maas logout "$profile" > /dev/null 2>&1 || true' EXIT
+      # shellcheck disable=SC2086 # UPDATE_ARGS is a list of key=value pairs
+      maas "$profile" vm-host update "$VM_HOST_ID" $UPDATE_ARGS > /dev/null
+    EOT
+    interpreter = ["bash", "-c"]
+
+    environment = {
+      MAAS_PROFILE = var.maas_profile
+      MAAS_API_URL = var.maas_api_url
+      MAAS_API_KEY = var.maas_api_key
+      VM_HOST_ID   = local.vm_host_ids[each.key]
+      UPDATE_ARGS  = join(" ", [for key, value in each.value : "${key}=${value}" if value != null])
+    }
+  }
+}
@@ -0,0 +1,23 @@
+output "vm_hosts" {
+  description = "Map of VM host names (including LXD cluster members) to IDs, for vm_configurations.vm_host"
+  value       = local.vm_host_ids
+}
+
+output "vm_host_zones" {
+  description = "Map of VM host names (including LXD cluster members) to zones"
+  value = merge(
+    { for name, host in maas_vm_host.vm_host : name => host.zone },
+    {
+      for member, host in data.maas_vm_host.cluster_member : member => local.cluster_members[member].zone
+      if local.cluster_members[member].zone != null
+    }
+  )
+}
+
+output "vm_host_types" {
+  description = "Map of VM host names to their type (lxd or virsh)"
+  value = merge(
+    { for name, host in var.vm_hosts : name => host.type },
+    { for member, host in local.cluster_members : member => host.type }
+  )
+}
@@ -0,0 +1,96 @@
+variable "vm_hosts" {
+  description = "Map of LXD and virsh VM hosts to register, keyed by VM host name"
+  type = map(object({
+    type = string
+    # Either the address of an existing LXD/libvirt endpoint (e.g.
+    # 10.0.0.5:8443 or qemu+ssh://ubuntu@10.0.0.6/system), or the hostname or
+    # system ID of a Ready machine MAAS deploys as a VM host
+    power_address = optional(string)
+    machine       = optional(string)
+    # virsh: SSH user of the libvirt endpoint
+    power_user = optional(string)
+    # LXD: project VMs are created in
+    project = optional(string)
+    # LXD: the other members of the LXD cluster the endpoint belongs to. MAAS
+    # registers every member as a VM host; listing them manages them here too
+    cluster_members = optional(list(string), [])
+
+    zone = optional(string)
+    pool = optional(string)
+    tags = optional(list(string), [])
+
+    cpu_over_commit_ratio    = optional(number, 1)
+    memory_over_commit_ratio = optional(number, 1)
+    # Storage pool used for VM disks that do not name a pool
+    default_storage_pool = optional(string)
+    default_macvlan_mode = optional(string)
+  }))
+  default = {}
+
+  validation {
+    condition     = alltrue([for name, host in var.vm_hosts : contains(["lxd", "virsh"], host.type)])
+    error_message = "VM host type must be lxd or virsh."
+  }
+
+  validation {
+    condition     = alltrue([for name, host in var.vm_hosts : (host.power_address == null) != (host.machine == null)])
+    error_message = "Each VM host needs exactly one of power_address or machine."
+  }
+
+  validation {
+    condition = alltrue([
+      for name, host in var.vm_hosts : host.type == "lxd" ? true : length(host.cluster_members) == 0 && host.project == null
+    ])
+    error_message = "cluster_members and project are only supported for lxd VM hosts."
+  }
+
+  validation {
+    condition = alltrue([
+      for name, host in var.vm_hosts : host.cpu_over_commit_ratio > 0 && host.memory_over_commit_ratio > 0
+    ])
+    error_message = "Overcommit ratios must be greater than zero."
+  }
+
+  validation {
+    condition = alltrue([
+      for name, host in var.vm_hosts : host.default_macvlan_mode == null ? true : contains(["bridge", "passthru", "private", "vepa"], host.default_macvlan_mode)
+    ])
+    error_message = "default_macvlan_mode must be one of bridge, passthru, private or vepa."
+  }
+
+  validation {
+    condition = length(flatten([for name, host in var.vm_hosts : concat([name], host.cluster_members)])) == length(distinct(flatten([
+      for name, host in var.vm_hosts : concat([name], host.cluster_members)
+    ])))
+    error_message = "VM host and cluster member names must be unique."
+  }
+}
+
+variable "vm_host_credentials" {
+  description = "Credentials of each VM host, keyed by VM host name: the LXD trust password or virsh SSH password (power_pass), or an LXD client certificate and key"
+  type = map(object({
+    power_pass  = optional(string)
+    certificate = optional(string)
+    key         = optional(string)
+  }))
+  default   = {}
+  sensitive = true
+}
+
+# MAAS API credentials
+variable "maas_api_url" {
+  description = "MAAS API URL"
+  type        = string
+}
+
+variable "maas_api_key" {
+  description = "MAAS API key for authentication"
+  type        = string
+  sensitive   = true
+}
+
+variable "maas_profile" {
+  description = "MAAS CLI profile name to use for local-exec provisioners"
+  type        = string
+  default     = "root"
+}
@@ -0,0 +1,21 @@
+# MAAS Wait For Machines Module
+# Readiness gate between units: blocks until every machine reaches the target
+# state, failing with a per-machine report when a machine fails or the timeout
+# expires.
+#
+# The check runs as an external data source so that it is evaluated before the
+# data sources and resources that depend on it, at plan time. maas-wait reads
+# the MAAS API URL and key from MAAS_API_URL/MAAS_API_KEY or the
+# TF_VAR_maas_api_url/TF_VAR_maas_api_key inputs Terragrunt exports.
+
+data "external" "wait" {
+  program = concat(var.wait_command, ["-external"])
+
+  query = {
+    machines     = join(",", var.machines)
+    state        = var.target_state
+    timeout      = var.timeout
+    interval     = var.poll_interval
+    max_interval = var.max_poll_interval
+  }
+}
@@ -0,0 +1,9 @@
+output "machine_ids" {
+  description = "Map of requested machine names to system IDs, known once every machine is in target_state"
+  value       = data.external.wait.result
+}
+
+output "target_state" {
+  description = "State every machine reached"
+  value       = var.target_state
+}
@@ -0,0 +1,39 @@
+variable "machines" {
+  description = "Hostnames or system IDs of the machines to wait for"
+  type        = list(string)
+}
+
+variable "target_state" {
+  description = "State every machine must reach: Ready, Allocated or Deployed (machines in a later state also pass)"
+  type        = string
+  default     = "Ready"
+
+  validation {
+    condition     = contains(["Ready", "Allocated", "Deployed"], var.target_state)
+    error_message = "target_state must be one of Ready, Allocated, Deployed."
+  }
+}
+
+variable "timeout" {
+  description = "How long to wait before failing, as a Go duration (e.g. 30m)"
+  type        = string
+  default     = "30m"
+}
+
+variable "poll_interval" {
+  description = "Initial poll interval, doubled after every poll up to max_poll_interval"
+  type        = string
+  default     = "10s"
+}
+
+variable "max_poll_interval" {
+  description = "Maximum poll interval"
+  type        = string
+  default     = "1m"
+}
+
+variable "wait_command" {
+  description = "Command running the maas-wait tool (see tools/cmd/maas-wait)"
+  type        = list(string)
+  default     = ["maas-wait"]
+}
@@ -0,0 +1,431 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeMAAS is an in-memory MAAS API serving the networking endpoints the
+// maas provider uses (spaces, fabrics, VLANs, subnets, IP ranges and rack
+// controllers). Like MAAS, it rejects VLANs in spaces that do not exist or
+// relaying to VLANs without DHCP, and refuses to delete spaces that still
+// have VLANs, and it records every change it makes so tests can assert on
+// the order Terraform applied them in.
+type fakeMAAS struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	nextID   int
+	spaces   map[int]map[string]interface{}
+	fabrics  map[int]map[string]interface{}
+	vlans    map[int]map[string]interface{}
+	subnets  map[int]map[string]interface{}
+	ipRanges map[int]map[string]interface{}
+	racks    map[string]map[string]interface{}
+	events   []string
+}
+
+// newFakeMAAS starts a fake MAAS, stopped when the test ends. Modules are
+// pointed at it with fakeMAASModule.
+func newFakeMAAS(t *testing.T) *fakeMAAS {
+	t.Helper()
+
+	f := &fakeMAAS{
+		nextID:   1,
+		spaces:   map[int]map[string]interface{}{},
+		fabrics:  map[int]map[string]interface{}{},
+		vlans:    map[int]map[string]interface{}{},
+		subnets:  map[int]map[string]interface{}{},
+		ipRanges: map[int]map[string]interface{}{},
+		racks:    map[string]map[string]interface{}{},
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// Events returns the changes made so far, e.g. "create space name=oam-space".
+func (f *fakeMAAS) Events() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.events...)
+}
+
+// EventIndex returns the position of the first event with the given prefix,
+// or -1.
+func (f *fakeMAAS) EventIndex(prefix string) int {
+	for i, event := range f.Events() {
+		if strings.HasPrefix(event, prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddRackController registers a rack controller and returns its system ID.
+func (f *fakeMAAS) AddRackController(hostname string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	systemID := fmt.Sprintf("rack%02d", len(f.racks)+1)
+	f.racks[systemID] = map[string]interface{}{"system_id": systemID, "hostname": hostname, "fqdn": hostname + ".maas"}
+	return systemID
+}
+
+// VLAN returns the VLAN with the given VID, or nil.
+func (f *fakeMAAS) VLAN(vid int) map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, vlan := range f.vlans {
+		if vlan["vid"] == vid {
+			return vlan
+		}
+	}
+	return nil
+}
+
+// Subnet returns the subnet with the given CIDR, or nil.
+func (f *fakeMAAS) Subnet(cidr string) map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, subnet := range f.subnets {
+		if subnet["cidr"] == cidr {
+			return subnet
+		}
+	}
+	return nil
+}
+
+func (f *fakeMAAS) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := r.ParseMultipartForm(1 << 20); err != nil && err != http.ErrNotMultipart {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/MAAS/api/2.0"), "/")
+	parts := strings.Split(path, "/")
+
+	var (
+		body interface{}
+		err  error
+	)
+	switch {
+	case len(parts) == 1 && parts[0] == "spaces":
+		body, err = f.collection(r, "space", f.spaces, f.newSpace)
+	case len(parts) == 2 && parts[0] == "spaces":
+		body, err = f.object(r, "space", f.spaces, parts[1], f.deleteSpace)
+	case len(parts) == 1 && parts[0] == "fabrics":
+		body, err = f.collection(r, "fabric", f.fabrics, f.newFabric)
+	case len(parts) == 2 && parts[0] == "fabrics":
+		body, err = f.object(r, "fabric", f.fabrics, parts[1], nil)
+	case len(parts) == 3 && parts[0] == "fabrics" && parts[2] == "vlans":
+		body, err = f.fabricVLANs(r, parts[1])
+	case len(parts) == 4 && parts[0] == "fabrics" && parts[2] == "vlans":
+		body, err = f.fabricVLAN(r, parts[1], parts[3])
+	case len(parts) == 2 && parts[0] == "vlans":
+		body, err = f.object(r, "vlan", f.vlans, parts[1], nil)
+	case len(parts) == 1 && parts[0] == "subnets":
+		body, err = f.collection(r, "subnet", f.subnets, f.newSubnet)
+	case len(parts) == 2 && parts[0] == "subnets":
+		body, err = f.object(r, "subnet", f.subnets, parts[1], nil)
+	case len(parts) == 1 && parts[0] == "rackcontrollers":
+		body, err = f.rackControllers(r)
+	case len(parts) == 2 && parts[0] == "rackcontrollers":
+		body, err = f.rackController(parts[1])
+	case len(parts) == 1 && parts[0] == "ipranges":
+		body, err = f.collection(r, "iprange", f.ipRanges, f.newIPRange)
+	case len(parts) == 2 && parts[0] == "ipranges":
+		body, err = f.object(r, "iprange", f.ipRanges, parts[1], nil)
+	default:
+		f.events = append(f.events, fmt.Sprintf("unhandled %s %s", r.Method, r.URL.Path))
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// collection lists (GET) or creates (POST) objects of one kind.
+func (f *fakeMAAS) collection(r *http.Request, kind string, objects map[int]map[string]interface{}, create func(*http.Request) (map[string]interface{}, error)) (interface{}, error) {
+	if r.Method != http.MethodPost {
+		list := []map[string]interface{}{}
+		for _, obj := range objects {
+			list = append(list, obj)
+		}
+		return list, nil
+	}
+	obj, err := create(r)
+	if err != nil {
+		return nil, err
+	}
+	obj["id"] = f.nextID
+	objects[f.nextID] = obj
+	f.nextID++
+	f.events = append(f.events, fmt.Sprintf("create %s %s", kind, describe(obj)))
+	return obj, nil
+}
+
+// object reads (GET), updates (PUT) or deletes (DELETE) one object.
+func (f *fakeMAAS) object(r *http.Request, kind string, objects map[int]map[string]interface{}, idStr string, canDelete func(int) error) (interface{}, error) {
+	id, _ := strconv.Atoi(idStr)
+	obj, ok := objects[id]
+	if !ok {
+		return nil, fmt.Errorf("%s %s does not exist", kind, idStr)
+	}
+	switch r.Method {
+	case http.MethodPut:
+		setFormFields(obj, r)
+		f.events = append(f.events, fmt.Sprintf("update %s %s", kind, describe(obj)))
+	case http.MethodDelete:
+		if canDelete != nil {
+			if err := canDelete(id); err != nil {
+				return nil, err
+			}
+		}
+		delete(objects, id)
+		f.events = append(f.events, fmt.Sprintf("delete %s %s", kind, describe(obj)))
+	}
+	return obj, nil
+}
+
+func (f *fakeMAAS) newSpace(r *http.Request) (map[string]interface{}, error) {
+	obj := map[string]interface{}{"description": "", "vlans": []interface{}{}, "subnets": []interface{}{}}
+	setFormFields(obj, r)
+	return obj, nil
+}
+
+// deleteSpace refuses to delete a space VLANs are still in.
+func (f *fakeMAAS) deleteSpace(id int) error {
+	name := f.spaces[id]["name"]
+	for _, vlan := range f.vlans {
+		if vlan["space"] == name {
+			return fmt.Errorf("space %v is still used by VLAN %v", name, vlan["name"])
+		}
+	}
+	return nil
+}
+
+func (f *fakeMAAS) newFabric(r *http.Request) (map[string]interface{}, error) {
+	obj := map[string]interface{}{"class_type": nil, "vlans": []interface{}{}}
+	setFormFields(obj, r)
+	return obj, nil
+}
+
+func (f *fakeMAAS) fabricVLANs(r *http.Request, fabricID string) (interface{}, error) {
+	id, _ := strconv.Atoi(fabricID)
+	fabric, ok := f.fabrics[id]
+	if !ok {
+		return nil, fmt.Errorf("fabric %s does not exist", fabricID)
+	}
+	if r.Method != http.MethodPost {
+		list := []map[string]interface{}{}
+		for _, vlan := range f.vlans {
+			if vlan["fabric_id"] == id {
+				list = append(list, vlan)
+			}
+		}
+		return list, nil
+	}
+	return f.collection(r, "vlan", f.vlans, func(r *http.Request) (map[string]interface{}, error) {
+		obj := map[string]interface{}{
+			"fabric_id": id, "fabric": fabric["name"], "mtu": 1500, "dhcp_on": false, "space": "undefined",
+			"primary_rack": nil, "secondary_rack": nil, "relay_vlan": nil, "external_dhcp": nil,
+		}
+		setFormFields(obj, r)
+		return obj, f.checkVLANSpace(obj)
+	})
+}
+
+func (f *fakeMAAS) fabricVLAN(r *http.Request, fabricID, vid string) (interface{}, error) {
+	id, _ := strconv.Atoi(fabricID)
+	v, _ := strconv.Atoi(vid)
+	for vlanID, vlan := range f.vlans {
+		if vlan["fabric_id"] == id && vlan["vid"] == v {
+			if r.Method == http.MethodPut {
+				update := map[string]interface{}{"space": vlan["space"]}
+				setFormFields(update, r)
+				if err := f.checkVLANSpace(update); err != nil {
+					return nil, err
+				}
+				if err := f.checkVLANDHCP(update); err != nil {
+					return nil, err
+				}
+			}
+			return f.object(r, "vlan", f.vlans, strconv.Itoa(vlanID), nil)
+		}
+	}
+	return nil, fmt.Errorf("VLAN %s does not exist in fabric %s", vid, fabricID)
+}
+
+// checkVLANSpace fails like MAAS does when a VLAN names a space that does not exist.
+func (f *fakeMAAS) checkVLANSpace(vlan map[string]interface{}) error {
+	space, _ := vlan["space"].(string)
+	if space == "" || space == "undefined" {
+		return nil
+	}
+	for id, s := range f.spaces {
+		if s["name"] == space || strconv.Itoa(id) == space {
+			vlan["space"] = s["name"]
+			return nil
+		}
+	}
+	return fmt.Errorf("space %q does not exist", space)
+}
+
+// checkVLANDHCP fails like MAAS does when a VLAN update names a rack
+// controller that does not exist, or relays to a VLAN without DHCP.
+func (f *fakeMAAS) checkVLANDHCP(update map[string]interface{}) error {
+	for _, key := range []string{"primary_rack", "secondary_rack"} {
+		if systemID, ok := update[key].(string); ok && systemID != "" {
+			if _, ok := f.racks[systemID]; !ok {
+				return fmt.Errorf("%s %q is not a rack controller", key, systemID)
+			}
+		}
+	}
+	if relay, ok := update["relay_vlan"].(int); ok {
+		target, ok := f.vlans[relay]
+		if !ok {
+			return fmt.Errorf("relay VLAN %d does not exist", relay)
+		}
+		if target["dhcp_on"] != true {
+			return fmt.Errorf("relay VLAN %d does not have DHCP enabled", relay)
+		}
+	}
+	return nil
+}
+
+func (f *fakeMAAS) rackControllers(r *http.Request) (interface{}, error) {
+	list := []map[string]interface{}{}
+	for _, rack := range f.racks {
+		if hostname := r.URL.Query().Get("hostname"); hostname == "" || rack["hostname"] == hostname {
+			list = append(list, rack)
+		}
+	}
+	return list, nil
+}
+
+func (f *fakeMAAS) rackController(systemID string) (interface{}, error) {
+	rack, ok := f.racks[systemID]
+	if !ok {
+		return nil, fmt.Errorf("rack controller %s does not exist", systemID)
+	}
+	return rack, nil
+}
+
+func (f *fakeMAAS) newSubnet(r *http.Request) (map[string]interface{}, error) {
+	obj := map[string]interface{}{
+		"gateway_ip": nil, "dns_servers": []string{}, "rdns_mode": 2, "allow_dns": true, "allow_proxy": true,
+		"managed": true, "active_discovery": false, "disabled_boot_architectures": []string{}, "description": "",
+	}
+	setFormFields(obj, r)
+	vlanID, _ := obj["vlan"].(int)
+	vlan, ok := f.vlans[vlanID]
+	if !ok {
+		return nil, fmt.Errorf("VLAN %v does not exist", obj["vlan"])
+	}
+	obj["vlan"] = vlan
+	obj["space"] = vlan["space"]
+	return obj, nil
+}
+
+func (f *fakeMAAS) newIPRange(r *http.Request) (map[string]interface{}, error) {
+	obj := map[string]interface{}{"comment": "", "user": nil}
+	setFormFields(obj, r)
+	subnetID, _ := obj["subnet"].(int)
+	subnet, ok := f.subnets[subnetID]
+	if !ok {
+		return nil, fmt.Errorf("subnet %v does not exist", obj["subnet"])
+	}
+	obj["subnet"] = subnet
+	return obj, nil
+}
+
+// setFormFields copies the request's form values into obj, converting the
+// fields MAAS returns as numbers, booleans and lists.
+func setFormFields(obj map[string]interface{}, r *http.Request) {
+	for key, values := range r.Form {
+		value := values[len(values)-1]
+		switch key {
+		case "vid", "mtu", "rdns_mode", "vlan", "fabric", "subnet", "relay_vlan":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				obj[key] = value
+				continue
+			}
+			obj[key] = n
+		case "dhcp_on", "allow_dns", "allow_proxy", "managed", "active_discovery":
+			obj[key], _ = strconv.ParseBool(value)
+		case "dns_servers", "disabled_boot_architectures":
+			obj[key] = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+		default:
+			obj[key] = value
+		}
+	}
+}
+
+// describe summarises an object for events: its name (or VID, or range) and space.
+func describe(obj map[string]interface{}) string {
+	var fields []string
+	for _, key := range []string{"name", "vid", "cidr", "start_ip", "end_ip", "space", "description"} {
+		if value, ok := obj[key]; ok && value != nil && value != "" {
+			fields = append(fields, fmt.Sprintf("%s=%v", key, value))
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// fakeMAASCLI puts a stub maas CLI first on PATH that records its arguments,
+// one call per line, in the returned log file. Use it for modules that run
+// the CLI in local-exec provisioners.
+func fakeMAASCLI(t *testing.T) (path, log string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	log = filepath.Join(dir, "maas.log")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$*\" >> %q\n", log)
+	if err := os.WriteFile(filepath.Join(dir, "maas"), []byte(script), 0o755); err != nil {
+		t.Fatalf("writing fake maas CLI: %v", err)
+	}
+	return dir + string(os.PathListSeparator) + os.Getenv("PATH"), log
+}
+
+// fakeMAASModule copies a module's Terraform files into a temporary
+// directory and adds the provider block Terragrunt units generate, pointed
+// at the fake MAAS, so the module can be applied on its own.
+func fakeMAASModule(t *testing.T, moduleDir string, f *fakeMAAS) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	files, err := filepath.Glob(filepath.Join(moduleDir, "*.tf"))
+	if err != nil {
+		t.Fatalf("listing %s: %v", moduleDir, err)
+	}
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("reading %s: %v", file, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(file)), content, 0o644); err != nil {
+			t.Fatalf("copying %s: %v", file, err)
+		}
+	}
+
+	provider := fmt.Sprintf("provider \"maas\" {\n  api_version = \"2.0\"\n  api_key     = \"consumer:token:secret\"\n  api_url     = %q\n}\n", f.URL+"/MAAS")
+	if err := os.WriteFile(filepath.Join(dir, "maas_provider.tf"), []byte(provider), 0o644); err != nil {
+		t.Fatalf("writing provider: %v", err)
+	}
+	return dir
+}
@@ -0,0 +1,168 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMaasCommissionMachinesModule tests the maas-commission-machines module
+// Skipped in CI - requires MAAS provider configuration
+func TestMaasCommissionMachinesModule(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+	t.Parallel()
+
+	// This test requires MAAS_API_URL and MAAS_API_KEY environment variables
+	// Run with: go test -v -run TestMaasCommissionMachinesModule (not in short mode)
+	t.Skip("Integration test - requires MAAS server")
+}
+
+// TestMaasCommissionMachinesModuleValidation tests input validation
+func TestMaasCommissionMachinesModuleValidation(t *testing.T) {
+	t.Parallel()
+
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: "../modules/maas-commission-machines",
+		Vars: map[string]interface{}{
+			"maas_api_url": "http://localhost:5240/MAAS",
+			"maas_api_key": "test:consumer:secret",
+			"machines": map[string]interface{}{
+				"compute-01": map[string]interface{}{
+					"tags": []string{"compute"},
+				},
+			},
+			"tag_scripts": map[string]interface{}{
+				"compute": map[string]interface{}{
+					"testing_scripts": []string{"smartctl-validate"},
+				},
+			},
+		},
+		NoColor: true,
+	})
+
+	// Initialize (validation happens during init)
+	terraform.Init(t, terraformOptions)
+}
+
+// TestMaasCommissionMachinesScriptSelection plans machines with their own and
+// tag scripts and checks the scripts uploaded and selected per machine
+func TestMaasCommissionMachinesScriptSelection(t *testing.T) {
+	t.Parallel()
+
+	scriptsDir := t.TempDir()
+	for _, name := range []string{"nvme-wear-check.sh", "gpu-burn.py", "README.md"} {
+		require.NoError(t, os.WriteFile(filepath.Join(scriptsDir, name), []byte("#!/bin/sh\n"), 0o644))
+	}
+
+	tfvars := fmt.Sprintf(`
+scripts_dir = %q
+machines = {
+  "compute-01" = { tags = ["compute", "nvme"], testing_scripts = ["memtester", "smartctl-validate"] }
+  "gpu-01"     = { tags = ["gpu"], commissioning_scripts = ["gpu-burn"] }
+  "plain-01"   = {}
+}
+tag_scripts = {
+  "compute" = { testing_scripts = ["smartctl-validate"] }
+  "nvme"    = { commissioning_scripts = ["nvme-wear-check"], testing_scripts = ["badblocks"] }
+  "gpu"     = { commissioning_scripts = ["gpu-burn"] }
+}
+`, scriptsDir)
+	out, values, err := planModule(t, "maas-commission-machines", tfvars, map[string]string{
+		"machine_scripts": `local.machine_scripts`,
+		"script_files":    `keys(local.script_files)`,
+	})
+	require.NoError(t, err, "Plan should succeed: %s", out)
+
+	assert.Equal(t, []interface{}{"gpu-burn", "nvme-wear-check"}, values["script_files"], "Only .sh and .py files should be uploaded, by name without extension")
+	assert.Equal(t, map[string]interface{}{
+		"compute-01": map[string]interface{}{
+			"commissioning_scripts": []interface{}{"nvme-wear-check"},
+			"testing_scripts":       []interface{}{"memtester", "smartctl-validate", "badblocks"},
+		},
+		"gpu-01": map[string]interface{}{
+			"commissioning_scripts": []interface{}{"gpu-burn"},
+			"testing_scripts":       []interface{}{},
+		},
+		"plain-01": map[string]interface{}{
+			"commissioning_scripts": []interface{}{},
+			"testing_scripts":       []interface{}{},
+		},
+	}, values["machine_scripts"], "Machines should run their own scripts then those of their tags, each once")
+}
+
+// TestMaasCommissionMachinesWaitsForReady runs the commissioning script with
+// a stub MAAS CLI and maas-wait and checks it commissions the machine with
+// its scripts, then waits for Ready
+func TestMaasCommissionMachinesWaitsForReady(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	log := filepath.Join(dir, "calls.log")
+	stubs := map[string]string{
+		"maas": fmt.Sprintf(`#!/bin/sh
+echo "maas $*" >> %q
+case "$2 $3" in
+  "machine read") echo '{"status_name": "New"}' ;;
+esac
+`, log),
+		"maas-wait": fmt.Sprintf("#!/bin/sh\necho \"maas-wait $*\" >> %q\n", log),
+	}
+	for name, script := range stubs {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755))
+	}
+
+	cmd := exec.Command("bash", "../modules/maas-commission-machines/commission-and-wait.sh")
+	cmd.Env = append(os.Environ(),
+		"PATH="+dir+string(os.PathListSeparator)+os.Getenv("PATH"),
+		"MAAS_PROFILE=root",
+		"MAAS_API_URL=http://localhost:5240/MAAS",
+		"MAAS_API_KEY=consumer:token:secret",
+		"MACHINE_ID=abc123",
+		"MACHINE_NAME=compute-01",
+		"COMMISSIONING_SCRIPTS=nvme-wear-check",
+		"TESTING_SCRIPTS=memtester,badblocks",
+		"TIMEOUT=60",
+		"POLL_INTERVAL=20",
+		"WAIT_COMMAND=maas-wait",
+	)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, "The script should succeed: %s", out)
+
+	calls, err := os.ReadFile(log)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(calls)), "\n")
+	require.Len(t, lines, 5, "Unexpected calls: %s", calls)
+	assert.Regexp(t, `^maas login root-commission-abc123-\d+ http://localhost:5240/MAAS consumer:token:secret$`, lines[0], "Should log in with a per-run profile")
+	profile := strings.Fields(lines[0])[2]
+	assert.Equal(t, "maas "+profile+" machine read abc123", lines[1])
+	assert.Equal(t, "maas "+profile+" machine commission abc123 commissioning_scripts=nvme-wear-check testing_scripts=memtester,badblocks", lines[2], "Should commission with the selected scripts")
+	assert.Equal(t, "maas-wait -state Ready -timeout 60s -interval 5s -max-interval 20s abc123", lines[3], "Should wait for Ready with maas-wait")
+	assert.Equal(t, "maas logout "+profile, lines[4], "Should log the per-run profile out")
+}
+
+// TestMaasCommissionMachinesTerragruntUnit tests the unit's module source,
+// dependencies and inputs
+func TestMaasCommissionMachinesTerragruntUnit(t *testing.T) {
+	t.Parallel()
+
+	unit := parseTerragruntUnit(t, "maas-commission-machines")
+	assert.Equal(t, "../../../modules//maas-commission-machines", unit.Source, "Should copy the sibling readiness gate module")
+	assert.Equal(t, "../maas-setup", unit.Dependencies["maas_setup"].ConfigPath, "Should depend on maas-setup")
+	assert.Equal(t, "../maas-enlist-machines", unit.Dependencies["machines"].ConfigPath, "Should depend on machine enlistment")
+	assert.Equal(t, "dependency.maas_setup.outputs.maas_api_url", unit.Inputs["maas_api_url"])
+	assert.Equal(t, "dependency.maas_setup.outputs.maas_api_key", unit.Inputs["maas_api_key"])
+	assert.Equal(t, `"${get_terragrunt_dir()}/scripts"`, unit.Inputs["scripts_dir"], "Should pass the unit's scripts directory")
+	assert.Equal(t, `"Ready"`, unit.Inputs["wait_for_state"], "Should wait for enlistment commissioning to finish")
+
+	assert.FileExists(t, "../clouds/prod/maas-commission-machines/commissioning.tfvars.example",
+		"Example commissioning configuration should exist")
+}
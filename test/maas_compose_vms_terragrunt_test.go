@@ -1,6 +1,7 @@
 package test
 
 import (
+	"fmt"
 	"os"
 	"testing"
 
@@ -120,6 +121,295 @@ func TestMaasComposeVmsVmHostSelection(t *testing.T) {
 	assert.Contains(t, contentStr, "length(vm_config.vm_host)", "Should check vm_host length for selection")
 }
 
+// composeVmsDataLocals stands in for the locals maas-compose-vms reads from
+// MAAS: the zone of each VM host and the hosts maas-vm-schedule chose
+const composeVmsDataLocals = `
+  vm_host_zones = {
+    "vmhost-1" = "az-1"
+    "vmhost-2" = "az-1"
+    "vmhost-3" = "az-2"
+    "vmhost-4" = "az-3"
+  }
+  scheduled_hosts = {
+    "workers-0" = "vmhost-3"
+    "workers-1" = "vmhost-3"
+  }
+`
+
+// planComposeVms plans tfvars against maas-compose-vms with the VM hosts of
+// composeVmsDataLocals
+func planComposeVms(t *testing.T, tfvars string, outputs map[string]string) (string, map[string]interface{}, error) {
+	t.Helper()
+	return planModuleWithLocals(t, "maas-compose-vms", composeVmsDataLocals, tfvars, outputs)
+}
+
+// TestMaasComposeVmsPlacementStrategies plans every placement strategy and
+// checks the VM host and zone each instance lands on
+func TestMaasComposeVmsPlacementStrategies(t *testing.T) {
+	t.Parallel()
+
+	tfvars := `
+vm_configurations = {
+  explicit = { vm_host = ["vmhost-1", "vmhost-2"], count = 3, cores = 2, memory = 4096 }
+  rr       = { vm_host = ["vmhost-1", "vmhost-2"], placement = "round-robin", count = 3, cores = 2, memory = 4096 }
+  spread   = { vm_host = ["vmhost-1", "vmhost-2", "vmhost-3", "vmhost-4"], placement = "spread-by-zone", count = 4, cores = 2, memory = 4096 }
+  pinned   = { vm_host = ["vmhost-1", "vmhost-3"], placement = "spread-by-zone", zone = ["az-9"], count = 2, cores = 2, memory = 4096 }
+  ha       = { vm_host = ["vmhost-1", "vmhost-2", "vmhost-4"], placement = "anti-affinity", count = 3, cores = 2, memory = 4096 }
+  workers  = { vm_host = [], placement = "capacity", count = 2, cores = 2, memory = 4096 }
+}
+`
+	out, values, err := planComposeVms(t, tfvars, map[string]string{
+		"vm_hosts": `{ for vm in local.vm_instances : vm.key => vm.vm_host }`,
+		"zones":    `{ for vm in local.vm_instances : vm.key => vm.zone }`,
+	})
+	require.NoError(t, err, "Plan should succeed: %s", out)
+
+	hosts := values["vm_hosts"].(map[string]interface{})
+	for key, want := range map[string]string{
+		// explicit reuses the last entry
+		"explicit-0": "vmhost-1", "explicit-1": "vmhost-2", "explicit-2": "vmhost-2",
+		"rr-0": "vmhost-1", "rr-1": "vmhost-2", "rr-2": "vmhost-1",
+		// az-1, az-2 and az-3 first, then the second host of az-1
+		"spread-0": "vmhost-1", "spread-1": "vmhost-3", "spread-2": "vmhost-4", "spread-3": "vmhost-2",
+		"ha-0": "vmhost-1", "ha-1": "vmhost-2", "ha-2": "vmhost-4",
+		"workers-0": "vmhost-3", "workers-1": "vmhost-3",
+	} {
+		assert.Equal(t, want, hosts[key], "VM host of %s", key)
+	}
+
+	zones := values["zones"].(map[string]interface{})
+	assert.Equal(t, "az-2", zones["spread-1"], "spread-by-zone VMs should default to the zone of their VM host")
+	assert.Equal(t, "az-1", zones["spread-3"], "spread-by-zone VMs should default to the zone of their VM host")
+	assert.Equal(t, "az-9", zones["pinned-1"], "A configured zone should take precedence over the VM host's zone")
+	assert.Nil(t, zones["rr-0"], "Other placements should have no zone by default")
+
+	runValidationCases(t, "maas-compose-vms", []validationCase{
+		{
+			name:    "anti-affinity with enough hosts",
+			tfvars:  `vm_configurations = { ha = { vm_host = ["vmhost-1", "vmhost-2"], placement = "anti-affinity", count = 2, cores = 2, memory = 4096 } }`,
+			wantErr: "",
+		},
+		{
+			name:    "anti-affinity with more VMs than hosts",
+			tfvars:  `vm_configurations = { ha = { vm_host = ["vmhost-1", "vmhost-2", "vmhost-1"], placement = "anti-affinity", count = 3, cores = 2, memory = 4096 } }`,
+			wantErr: "Anti-affinity placement needs at least as many distinct vm_host entries as count: ha (3 VMs, 2 hosts).",
+		},
+		{
+			name:    "unknown placement",
+			tfvars:  `vm_configurations = { vms = { vm_host = ["vmhost-1"], placement = "random", count = 1, cores = 2, memory = 4096 } }`,
+			wantErr: "placement must be one of explicit, round-robin, spread-by-zone, anti-affinity, capacity.",
+		},
+	})
+}
+
+// TestMaasComposeVmsGroupedOutputs tests VMs are output by configuration and by tag with FQDNs and IPs
+func TestMaasComposeVmsGroupedOutputs(t *testing.T) {
+	t.Parallel()
+
+	outputs, err := os.ReadFile("../modules/maas-compose-vms/outputs.tf")
+	require.NoError(t, err, "Should be able to read outputs.tf")
+
+	outputsStr := string(outputs)
+	assert.Contains(t, outputsStr, "output \"vms_by_configuration\"", "Should group VMs by configuration")
+	assert.Contains(t, outputsStr, "output \"vms_by_tag\"", "Should group VMs by tag")
+
+	content, err := os.ReadFile("../modules/maas-compose-vms/main.tf")
+	require.NoError(t, err, "Should be able to read main.tf")
+	contentStr := string(content)
+	assert.Contains(t, contentStr, "fqdn          = try(maas_instance.vm[k].fqdn", "Should output FQDNs")
+	assert.Contains(t, contentStr, "ip_addresses = {", "Should output an address per network interface")
+}
+
+// TestMaasComposeVmsPostCompose tests waiting, network/storage profiles and deployment after composition
+func TestMaasComposeVmsPostCompose(t *testing.T) {
+	t.Parallel()
+
+	content, err := os.ReadFile("../modules/maas-compose-vms/main.tf")
+	require.NoError(t, err, "Should be able to read main.tf")
+
+	contentStr := string(content)
+	assert.Contains(t, contentStr, "source = \"../maas-wait-for-machines\"", "Should wait for commissioning")
+	assert.Contains(t, contentStr, "source = \"../maas-configure-nodes-networking\"", "Should reuse the node networking module")
+	assert.Contains(t, contentStr, "source = \"../maas-configure-nodes-storage\"", "Should reuse the node storage module")
+	assert.Contains(t, contentStr, "data \"external\" \"vm_block_devices\"", "Should read the composed disks")
+	assert.Contains(t, contentStr, "resource \"maas_instance\" \"vm\"", "Should deploy configured VMs")
+
+	outputs, err := os.ReadFile("../modules/maas-compose-vms/outputs.tf")
+	require.NoError(t, err, "Should be able to read outputs.tf")
+	assert.Contains(t, string(outputs), "output \"vm_ip_addresses\"", "Should output IPs for juju-bootstrap")
+
+	unit, err := os.ReadFile("../clouds/prod/maas-compose-vms/terragrunt.hcl")
+	require.NoError(t, err, "Should be able to read terragrunt.hcl")
+	assert.Contains(t, string(unit), "modules//maas-compose-vms", "Should copy the sibling modules")
+
+	// Modules called with depends_on cannot configure their own provider
+	networking, err := os.ReadFile("../modules/maas-configure-nodes-networking/provider.tf")
+	require.NoError(t, err, "Should be able to read the networking provider.tf")
+	assert.NotContains(t, string(networking), "provider \"maas\"", "Networking module should not configure the provider")
+}
+
+// TestMaasComposeVmsDiskOverrides plans shared and per-instance disks and
+// checks the composed disk order and the disks tagged after composition
+func TestMaasComposeVmsDiskOverrides(t *testing.T) {
+	t.Parallel()
+
+	tfvars := `
+vm_configurations = {
+  control = {
+    vm_host = ["vmhost-1"], count = 2, cores = 2, memory = 4096
+    storage_disks = [
+      { size_gigabytes = 500, pool = "data", tags = ["db-data"] },
+      { size_gigabytes = 60, boot = true },
+    ]
+    storage_disk_overrides = {
+      "1" = [
+        { size_gigabytes = 2000, pool = "data", tags = ["cos-data"] },
+        { size_gigabytes = 100, boot = true },
+      ]
+    }
+  }
+}
+`
+	out, values, err := planComposeVms(t, tfvars, map[string]string{
+		"disks":     `{ for vm in local.vm_instances : vm.key => [for disk in vm.storage_disks : "${disk.size_gigabytes}:${coalesce(disk.pool, "-")}"] }`,
+		"disk_tags": `{ for k, disk in local.disk_tags : k => disk.tags }`,
+	})
+	require.NoError(t, err, "Plan should succeed: %s", out)
+
+	assert.Equal(t, map[string]interface{}{
+		"control-0": []interface{}{"60:-", "500:data"},
+		"control-1": []interface{}{"100:-", "2000:data"},
+	}, values["disks"], "Instances should compose their override or the shared disks, boot disk first")
+	assert.Equal(t, map[string]interface{}{
+		"control-0.1": []interface{}{"db-data"},
+		"control-1.1": []interface{}{"cos-data"},
+	}, values["disk_tags"], "Tagged disks should be keyed by their position in the composed order")
+
+	runValidationCases(t, "maas-compose-vms", []validationCase{
+		{
+			name:    "two boot disks",
+			tfvars:  `vm_configurations = { vms = { vm_host = ["vmhost-1"], count = 1, cores = 2, memory = 4096, storage_disks = [{ size_gigabytes = 60, boot = true }, { size_gigabytes = 100, boot = true }] } }`,
+			wantErr: "At most one storage disk of a VM can be the boot disk.",
+		},
+		{
+			name:    "two boot disks in an override",
+			tfvars:  `vm_configurations = { vms = { vm_host = ["vmhost-1"], count = 2, cores = 2, memory = 4096, storage_disk_overrides = { "1" = [{ size_gigabytes = 60, boot = true }, { size_gigabytes = 100, boot = true }] } } }`,
+			wantErr: "At most one storage disk of a VM can be the boot disk.",
+		},
+		{
+			name:    "override index beyond count",
+			tfvars:  `vm_configurations = { vms = { vm_host = ["vmhost-1"], count = 2, cores = 2, memory = 4096, storage_disk_overrides = { "2" = [{ size_gigabytes = 60 }] } } }`,
+			wantErr: "storage_disk_overrides keys must be instance indexes from 0 to count - 1.",
+		},
+		{
+			name:    "invalid disk tag",
+			tfvars:  `vm_configurations = { vms = { vm_host = ["vmhost-1"], count = 1, cores = 2, memory = 4096, storage_disks = [{ size_gigabytes = 60, tags = ["db data"] }] } }`,
+			wantErr: "disk tags may only contain letters, digits, hyphens and underscores.",
+		},
+	})
+}
+
+// TestMaasComposeVmsStaticIPs plans per-instance static addresses from a list
+// and from a start address, and checks start addresses that leave the subnet
+// fail validation
+func TestMaasComposeVmsStaticIPs(t *testing.T) {
+	t.Parallel()
+
+	tfvars := `
+vm_configurations = {
+  db = {
+    vm_host = ["vmhost-1"], count = 2, cores = 2, memory = 4096
+    network = [{ name = "eth0", subnet_cidr = "10.0.2.0/24", ip_addresses = ["10.0.2.21", "10.0.2.42"] }]
+  }
+  gpu = {
+    vm_host = ["vmhost-1"], count = 3, cores = 2, memory = 4096
+    network = [
+      { name = "eth0", subnet_cidr = "192.168.0.0/16", ip_address_start = "192.168.1.254" },
+      { name = "eth1", subnet_cidr = "10.0.3.0/24" },
+    ]
+  }
+}
+`
+	out, values, err := planComposeVms(t, tfvars, map[string]string{
+		"addresses": `{ for vm in local.vm_instances : vm.key => { for nic in vm.network : nic.name => nic.ip_address } }`,
+	})
+	require.NoError(t, err, "Plan should succeed: %s", out)
+
+	assert.Equal(t, map[string]interface{}{
+		"db-0":  map[string]interface{}{"eth0": "10.0.2.21"},
+		"db-1":  map[string]interface{}{"eth0": "10.0.2.42"},
+		"gpu-0": map[string]interface{}{"eth0": "192.168.1.254", "eth1": nil},
+		"gpu-1": map[string]interface{}{"eth0": "192.168.1.255", "eth1": nil},
+		"gpu-2": map[string]interface{}{"eth0": "192.168.2.0", "eth1": nil},
+	}, values["addresses"], "Instance i should get ip_addresses[i] or ip_address_start + i, carrying into the next octet")
+
+	nic := func(count int, settings string) string {
+		return fmt.Sprintf(`vm_configurations = { vms = { vm_host = ["vmhost-1"], count = %d, cores = 2, memory = 4096, network = [{ name = "eth0", %s }] } }`, count, settings)
+	}
+	runValidationCases(t, "maas-compose-vms", []validationCase{
+		{
+			name:    "start address with room for count",
+			tfvars:  nic(5, `subnet_cidr = "10.0.1.0/24", ip_address_start = "10.0.1.250"`),
+			wantErr: "",
+		},
+		{
+			name:    "start address running past the subnet",
+			tfvars:  nic(10, `subnet_cidr = "10.0.1.0/24", ip_address_start = "10.0.1.250"`),
+			wantErr: "ip_address_start must be an IPv4 address inside subnet_cidr, leaving room for count addresses.",
+		},
+		{
+			name:    "start address outside the subnet",
+			tfvars:  nic(2, `subnet_cidr = "10.0.1.0/24", ip_address_start = "10.0.2.10"`),
+			wantErr: "ip_address_start must be an IPv4 address inside subnet_cidr, leaving room for count addresses.",
+		},
+		{
+			name:    "listed address outside the subnet",
+			tfvars:  nic(2, `subnet_cidr = "10.0.1.0/24", ip_addresses = ["10.0.1.10", "10.0.9.11"]`),
+			wantErr: "Static addresses must be valid addresses inside the network interface's subnet_cidr.",
+		},
+		{
+			name:    "fewer listed addresses than count",
+			tfvars:  nic(3, `subnet_cidr = "10.0.1.0/24", ip_addresses = ["10.0.1.10", "10.0.1.11"]`),
+			wantErr: "ip_addresses must list an address for each of count instances.",
+		},
+	})
+}
+
+// TestMaasComposeVmsNameResolution tests VM hosts, zones and pools are referenced by name through data sources
+func TestMaasComposeVmsNameResolution(t *testing.T) {
+	t.Parallel()
+
+	content, err := os.ReadFile("../modules/maas-compose-vms/main.tf")
+	require.NoError(t, err, "Should be able to read main.tf")
+
+	contentStr := string(content)
+	for _, dataSource := range []string{"maas_vm_host", "maas_zone", "maas_resource_pool"} {
+		assert.Contains(t, contentStr, "data \""+dataSource+"\"", "Should resolve names with "+dataSource)
+	}
+	assert.Contains(t, contentStr, "data.maas_vm_host.vm_host[each.value.vm_host].id", "Should compose on the resolved VM host ID")
+
+	example, err := os.ReadFile("../modules/maas-compose-vms/vms.tfvars.example")
+	require.NoError(t, err, "Should be able to read vms.tfvars.example")
+	assert.Contains(t, string(example), "vm_host         = [\"vmhost-1\"]", "Example should reference VM hosts by name")
+}
+
+// TestMaasComposeVmsCapacityScheduling tests capacity-aware host selection through maas-vm-schedule
+func TestMaasComposeVmsCapacityScheduling(t *testing.T) {
+	t.Parallel()
+
+	content, err := os.ReadFile("../modules/maas-compose-vms/main.tf")
+	require.NoError(t, err, "Should be able to read main.tf")
+
+	contentStr := string(content)
+	assert.Contains(t, contentStr, "data \"external\" \"schedule\"", "Should schedule through an external data source")
+	assert.Contains(t, contentStr, "jsonencode(local.schedule_requests)", "Should send every instance as a scheduling request")
+	assert.Contains(t, contentStr, "data.external.schedule[0].result", "Should use the scheduled VM host")
+
+	variables, err := os.ReadFile("../modules/maas-compose-vms/variables.tf")
+	require.NoError(t, err, "Should be able to read variables.tf")
+	assert.Contains(t, string(variables), "[\"bin-pack\", \"spread\"]", "Should validate the capacity policy")
+}
+
 // TestMaasComposeVmsZoneSelection tests that module supports zone as list
 func TestMaasComposeVmsZoneSelection(t *testing.T) {
 	t.Parallel()
@@ -144,6 +434,90 @@ func TestMaasComposeVmsTagSupport(t *testing.T) {
 	assert.Contains(t, contentStr, "vm_config.tags", "Should reference tags from configuration")
 }
 
+// TestMaasComposeVmsSharedTags plans VMs sharing tags and checks each tag is
+// aggregated across VMs, with tags created by maas-config left to it
+func TestMaasComposeVmsSharedTags(t *testing.T) {
+	t.Parallel()
+
+	tfvars := `
+vm_configurations = {
+  web     = { vm_host = ["vmhost-1"], count = 2, cores = 2, memory = 4096, tags = ["web", "production"] }
+  compute = { vm_host = ["vmhost-4"], count = 1, cores = 2, memory = 4096, tags = ["compute", "production"] }
+}
+managed_tags = ["compute", "hugepages"]
+`
+	out, values, err := planComposeVms(t, tfvars, map[string]string{
+		"tag_vms":         `local.tag_vms`,
+		"owned_tag_vms":   `local.owned_tag_vms`,
+		"managed_tag_vms": `local.managed_tag_vms`,
+	})
+	require.NoError(t, err, "Plan should succeed: %s", out)
+
+	assert.Equal(t, map[string]interface{}{
+		"web":        []interface{}{"web-0", "web-1"},
+		"production": []interface{}{"compute-0", "web-0", "web-1"},
+		"compute":    []interface{}{"compute-0"},
+	}, values["tag_vms"], "Every tag should list all VMs carrying it")
+	assert.Equal(t, map[string]interface{}{
+		"web":        []interface{}{"web-0", "web-1"},
+		"production": []interface{}{"compute-0", "web-0", "web-1"},
+	}, values["owned_tag_vms"], "Only tags not created by another unit should be a maas_tag of this module")
+	assert.Equal(t, map[string]interface{}{
+		"compute-0.compute": map[string]interface{}{"vm_key": "compute-0", "tag": "compute"},
+	}, values["managed_tag_vms"], "VMs should be added to managed tags one by one")
+
+	unit := parseTerragruntUnit(t, "maas-compose-vms")
+	assert.Equal(t, "keys(dependency.maas_config.outputs.tags)", unit.Inputs["managed_tags"], "The unit should leave the tags of maas-config to it")
+	assert.False(t, unit.Dependencies["maas_config"].SkipOutputs, "The unit should read the real tags of maas-config")
+}
+
+// TestMaasComposeVmsCpuPinning plans explicitly pinned and NUMA-placed VMs
+// and checks the cores each instance is pinned to
+func TestMaasComposeVmsCpuPinning(t *testing.T) {
+	t.Parallel()
+
+	tfvars := `
+vm_configurations = {
+  gateway = { vm_host = ["vmhost-1"], count = 3, cores = 2, memory = 4096, pinned_cores = [[4, 5], [6, 7]] }
+  compute = { vm_host = ["vmhost-4"], count = 3, cores = 2, memory = 4096, numa_nodes = [0, 0, 1], hugepages_backed = true }
+  full    = { vm_host = ["vmhost-4"], count = 1, cores = 3, memory = 4096, numa_nodes = [1] }
+}
+numa_topology = {
+  "vmhost-4" = {
+    "0" = [0, 1, 2, 3]
+    "1" = [8, 9, 10, 11]
+  }
+}
+`
+	out, values, err := planComposeVms(t, tfvars, map[string]string{
+		"pinned_cores": `{ for k, vm in local.vm_instances_map : k => vm.pinned_cores }`,
+		"hugepages":    `{ for k, vm in local.vm_instances_map : k => vm.hugepages_backed }`,
+	})
+	require.NoError(t, err, "Plan should succeed: %s", out)
+
+	pinned := values["pinned_cores"].(map[string]interface{})
+	assert.Equal(t, []interface{}{4.0, 5.0}, pinned["gateway-0"], "Instance i should be pinned to pinned_cores[i]")
+	assert.Equal(t, []interface{}{6.0, 7.0}, pinned["gateway-2"], "Instances past the list should reuse its last entry")
+	assert.Equal(t, []interface{}{0.0, 1.0}, pinned["compute-0"], "NUMA-placed VMs should take the first free cores of the node")
+	assert.Equal(t, []interface{}{2.0, 3.0}, pinned["compute-1"], "NUMA-placed VMs should take the cores after earlier VMs on the node")
+	assert.Equal(t, []interface{}{8.0, 9.0}, pinned["compute-2"], "NUMA-placed VMs should take cores of their own node")
+	assert.Nil(t, pinned["full-0"], "VMs that do not fit their NUMA node should not be pinned (the compose precondition fails)")
+	assert.Equal(t, true, values["hugepages"].(map[string]interface{})["compute-0"], "Hugepages backing should be passed per instance")
+
+	runValidationCases(t, "maas-compose-vms", []validationCase{
+		{
+			name:    "pinned cores shorter than cores",
+			tfvars:  `vm_configurations = { gateway = { vm_host = ["vmhost-1"], count = 2, cores = 4, memory = 4096, pinned_cores = [[0, 1, 2, 3], [4, 5]] } }`,
+			wantErr: "Every pinned_cores list must have exactly as many entries as cores.",
+		},
+		{
+			name:    "pinned cores and NUMA nodes",
+			tfvars:  `vm_configurations = { gateway = { vm_host = ["vmhost-1"], count = 1, cores = 2, memory = 4096, pinned_cores = [[0, 1]], numa_nodes = [0] } }`,
+			wantErr: "pinned_cores and numa_nodes are mutually exclusive",
+		},
+	})
+}
+
 // TestMaasComposeVmsHostnameGeneration tests hostname generation logic
 func TestMaasComposeVmsHostnameGeneration(t *testing.T) {
 	t.Parallel()
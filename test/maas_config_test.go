@@ -0,0 +1,100 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMaasConfigModuleValidation plans configuration tfvars against the
+// module's variables and checks malformed tags and domains fail validation
+func TestMaasConfigModuleValidation(t *testing.T) {
+	t.Parallel()
+
+	example, err := os.ReadFile("../clouds/prod/maas-config/config.tfvars.example")
+	require.NoError(t, err, "Should be able to read config.tfvars.example")
+
+	runValidationCases(t, "maas-config", []validationCase{
+		{
+			name: "valid",
+			tfvars: `
+				zones = { "az1" = { description = "Rack 1" } }
+				tags  = { "nvme" = { definition = "//node[@class='storage']/product[contains(., 'NVMe')]" } }`,
+		},
+		{
+			name:    "tag name",
+			tfvars:  `tags = { "fast disks" = {} }`,
+			wantErr: "Tag names may only contain letters, digits, hyphens and underscores.",
+		},
+		{
+			name:    "empty definition",
+			tfvars:  `tags = { "nvme" = { definition = " " } }`,
+			wantErr: "Tag definitions must be non-empty XPath expressions; omit definition for manual tags.",
+		},
+		{
+			name: "two default domains",
+			tfvars: `domains = {
+				"a.example.com" = { is_default = true }
+				"b.example.com" = { is_default = true }
+			}`,
+			wantErr: "At most one domain can be the default domain.",
+		},
+		{name: "example", tfvars: string(example)},
+	})
+}
+
+// TestMaasConfigModuleDefaults plans zones, tags and domains and checks the
+// values they are created with, defaults included
+func TestMaasConfigModuleDefaults(t *testing.T) {
+	t.Parallel()
+
+	tfvars := `
+zones = { "az1" = {} }
+tags = {
+  "compute" = { comment = "Sunbeam compute nodes" }
+  "nvme"    = { definition = "//node[@class='storage']/product[contains(., 'NVMe')]" }
+}
+domains = {
+  "sunbeam.example.com" = { ttl = 300, is_default = true }
+  "juju.example.com"    = {}
+}
+`
+	out, values, err := planModule(t, "maas-config", tfvars, map[string]string{
+		"zones":   "var.zones",
+		"tags":    "var.tags",
+		"domains": "var.domains",
+	})
+	require.NoError(t, err, "Plan should succeed: %s", out)
+
+	assert.Equal(t, map[string]interface{}{"az1": map[string]interface{}{"description": ""}}, values["zones"],
+		"Zones should default to an empty description")
+	assert.Equal(t, map[string]interface{}{
+		"compute": map[string]interface{}{"comment": "Sunbeam compute nodes", "definition": nil, "kernel_opts": nil},
+		"nvme":    map[string]interface{}{"comment": "", "definition": "//node[@class='storage']/product[contains(., 'NVMe')]", "kernel_opts": nil},
+	}, values["tags"], "Manual tags should have no definition and definition tags keep their XPath")
+	assert.Equal(t, map[string]interface{}{
+		"sunbeam.example.com": map[string]interface{}{"ttl": float64(300), "authoritative": true, "is_default": true},
+		"juju.example.com":    map[string]interface{}{"ttl": nil, "authoritative": true, "is_default": false},
+	}, values["domains"], "Domains should default to authoritative and not the default domain")
+}
+
+// TestMaasConfigTerragruntUnit tests the unit uses the local module and is a dependency of the machine units
+func TestMaasConfigTerragruntUnit(t *testing.T) {
+	t.Parallel()
+
+	content, err := os.ReadFile("../clouds/prod/maas-config/terragrunt.hcl")
+	require.NoError(t, err, "Should be able to read terragrunt.hcl")
+
+	contentStr := string(content)
+	assert.Contains(t, contentStr, "../../../modules/maas-config\"", "Should source the local module")
+	assert.NotContains(t, contentStr, "git::", "Should not use an external module")
+	assert.FileExists(t, "../clouds/prod/maas-config/config.tfvars.example", "Example configuration should exist")
+
+	for _, unit := range []string{"maas-enlist-machines", "maas-compose-vms"} {
+		hcl, err := os.ReadFile("../clouds/prod/" + unit + "/terragrunt.hcl")
+		require.NoError(t, err, "Should be able to read "+unit+" terragrunt.hcl")
+		assert.Contains(t, string(hcl), "config_path = \"../maas-config\"", unit+" should depend on maas-config")
+	}
+}
@@ -1,10 +1,14 @@
 package test
 
 import (
+	"fmt"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestMaasConfigureNetworkingModule tests the maas-configure-networking module
@@ -29,9 +33,8 @@ func TestMaasConfigureNetworkingModuleValidation(t *testing.T) {
 			"spaces": map[string]interface{}{},
 			"fabrics": map[string]interface{}{
 				"fabric1": map[string]interface{}{
-					"vlans": []interface{}{
-						map[string]interface{}{
-							"vid": 100,
+					"vlans": map[string]interface{}{
+						"100": map[string]interface{}{
 							"subnets": map[string]interface{}{
 								"subnet1": map[string]interface{}{
 									"cidr":     "192.168.1.0/24",
@@ -66,3 +69,654 @@ func TestMaasConfigureNetworkingOutputs(t *testing.T) {
 	// This is a structural test that doesn't require provider configuration
 	assert.FileExists(t, "../modules/maas-configure-networking/outputs.tf", "Module should have outputs.tf")
 }
+
+// TestMaasConfigureNetworkingSpaces plans spaces and VLANs against the
+// module's variables and locals and checks the space each VLAN is put in
+func TestMaasConfigureNetworkingSpaces(t *testing.T) {
+	t.Parallel()
+
+	tfvars := `
+spaces = {
+  "oam-space"   = { description = "Operations, administration and management" }
+  "admin-space" = {}
+}
+fabrics = {
+  "management-fabric" = {
+    vlans = {
+      "oam"  = { vid = 3400, space = "oam-space", subnets = { "oam" = { cidr = "10.0.2.0/24" } } }
+      "3402" = { space = "admin-space", subnets = { "admin" = { cidr = "10.0.3.0/24" } } }
+      "3403" = { subnets = { "unspaced" = { cidr = "10.0.4.0/24" } } }
+    }
+  }
+}
+`
+	out, values, err := planModule(t, "maas-configure-networking", tfvars, map[string]string{
+		"descriptions": `{ for name, space in var.spaces : name => coalesce(space.description, "-") }`,
+		"vlan_spaces":  `{ for key, vlan in local.vlans_map : key => coalesce(vlan.space, "-") }`,
+	})
+	require.NoError(t, err, "Plan should succeed: %s", out)
+
+	assert.Equal(t, map[string]interface{}{
+		"oam-space":   "Operations, administration and management",
+		"admin-space": "-",
+	}, values["descriptions"], "Spaces should keep their descriptions")
+	assert.Equal(t, map[string]interface{}{
+		"management-fabric-3400": "oam-space",
+		"management-fabric-3402": "admin-space",
+		"management-fabric-3403": "-",
+	}, values["vlan_spaces"], "VLANs keyed by name or vid should be put in their space")
+
+	runValidationCases(t, "maas-configure-networking", []validationCase{
+		{
+			name:    "description type",
+			tfvars:  `spaces = { "oam-space" = { description = ["oam"] } }`,
+			wantErr: "string required",
+		},
+		{
+			name:    "VLAN keyed by name without vid",
+			tfvars:  `fabrics = { "f" = { vlans = { "oam" = { space = "oam-space", subnets = {} } } } }`,
+			wantErr: "VLANs keyed by name must set vid.",
+		},
+	})
+}
+
+// TestMaasConfigureNetworkingSpaceOrdering applies the module to a fake MAAS
+// and checks spaces are created before, and destroyed after, their VLANs
+func TestMaasConfigureNetworkingSpaceOrdering(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeMAAS(t)
+	path, cliLog := fakeMAASCLI(t)
+
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: fakeMAASModule(t, "../modules/maas-configure-networking", fake),
+		Vars: map[string]interface{}{
+			"maas_api_url": fake.URL + "/MAAS",
+			"maas_api_key": "consumer:token:secret",
+			"spaces": map[string]interface{}{
+				"oam-space":      map[string]interface{}{"description": "Operations, administration and management"},
+				"internal-space": map[string]interface{}{},
+			},
+			"fabrics": map[string]interface{}{
+				"management-fabric": map[string]interface{}{
+					"vlans": map[string]interface{}{
+						"oam": map[string]interface{}{
+							"vid":   3400,
+							"space": "oam-space",
+							"subnets": map[string]interface{}{
+								"oam": map[string]interface{}{"cidr": "10.0.2.0/24"},
+							},
+						},
+						"internal": map[string]interface{}{
+							"vid":   3403,
+							"space": "internal-space",
+							"subnets": map[string]interface{}{
+								"internal": map[string]interface{}{"cidr": "10.0.7.0/24"},
+							},
+						},
+					},
+				},
+			},
+		},
+		EnvVars: map[string]string{"PATH": path},
+		NoColor: true,
+	})
+
+	terraform.InitAndApply(t, terraformOptions)
+
+	for _, space := range []string{"oam-space", "internal-space"} {
+		spaceCreated := fake.EventIndex("create space name=" + space)
+		require.NotEqual(t, -1, spaceCreated, "Space %s should be created", space)
+		vlanCreated := -1
+		for i, event := range fake.Events() {
+			if strings.HasPrefix(event, "create vlan") && strings.HasSuffix(event, "space="+space) {
+				vlanCreated = i
+			}
+		}
+		require.NotEqual(t, -1, vlanCreated, "A VLAN should be created in space %s", space)
+		assert.Less(t, spaceCreated, vlanCreated, "Space %s should be created before its VLAN: %v", space, fake.Events())
+	}
+
+	cliCalls, err := os.ReadFile(cliLog)
+	require.NoError(t, err, "The MAAS CLI should be called")
+	assert.Contains(t, string(cliCalls), "space update", "Should update the space description")
+	assert.Contains(t, string(cliCalls), "description=Operations, administration and management", "Should pass the description")
+	assert.Equal(t, 1, strings.Count(string(cliCalls), "space update"), "Should not update spaces without a description")
+
+	terraform.Destroy(t, terraformOptions)
+
+	events := fake.Events()
+	assert.NotContains(t, strings.Join(events, "\n"), "still used by VLAN", "Spaces should be destroyed after their VLANs")
+	assert.Greater(t, fake.EventIndex("delete space name=oam-space"), fake.EventIndex("delete vlan"), "VLANs should be deleted first: %v", events)
+}
+
+// TestMaasConfigureNetworkingSubnetOptions applies subnets with and without
+// DNS, proxy and management options to a fake MAAS
+func TestMaasConfigureNetworkingSubnetOptions(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeMAAS(t)
+	path, _ := fakeMAASCLI(t)
+
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: fakeMAASModule(t, "../modules/maas-configure-networking", fake),
+		Vars: map[string]interface{}{
+			"maas_api_url": fake.URL + "/MAAS",
+			"maas_api_key": "consumer:token:secret",
+			"fabrics": map[string]interface{}{
+				"data-fabric": map[string]interface{}{
+					"vlans": map[string]interface{}{
+						"internal": map[string]interface{}{
+							"vid": 3403,
+							"subnets": map[string]interface{}{
+								"internal": map[string]interface{}{"cidr": "10.0.7.0/24"},
+							},
+						},
+						"provider": map[string]interface{}{
+							"vid": 3409,
+							"subnets": map[string]interface{}{
+								"provider": map[string]interface{}{
+									"cidr":                        "192.0.2.0/28",
+									"allow_dns":                   false,
+									"allow_proxy":                 false,
+									"managed":                     false,
+									"rdns_mode":                   0,
+									"active_discovery":            true,
+									"disabled_boot_architectures": []string{"pxe"},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		EnvVars: map[string]string{"PATH": path},
+		NoColor: true,
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	internal := fake.Subnet("10.0.7.0/24")
+	require.NotNil(t, internal, "The internal subnet should be created")
+	assert.Equal(t, true, internal["allow_dns"], "allow_dns should default to true")
+	assert.Equal(t, true, internal["allow_proxy"], "allow_proxy should default to true")
+	assert.Equal(t, 2, internal["rdns_mode"], "rdns_mode should default to 2")
+	assert.Equal(t, true, internal["managed"], "managed should default to true")
+
+	provider := fake.Subnet("192.0.2.0/28")
+	require.NotNil(t, provider, "The provider subnet should be created")
+	assert.Equal(t, false, provider["allow_dns"], "allow_dns should be disabled")
+	assert.Equal(t, false, provider["allow_proxy"], "allow_proxy should be disabled")
+	assert.Equal(t, 0, provider["rdns_mode"], "rdns_mode should be disabled")
+	assert.Equal(t, false, provider["managed"], "The subnet should be unmanaged")
+	assert.Equal(t, true, provider["active_discovery"], "Active discovery should be enabled")
+	assert.Equal(t, []string{"pxe"}, provider["disabled_boot_architectures"], "PXE should be disabled")
+}
+
+// TestMaasConfigureNetworkingSubnetOptionsPlan plans subnets with and without
+// DNS, proxy and management options and checks the options each subnet gets
+func TestMaasConfigureNetworkingSubnetOptionsPlan(t *testing.T) {
+	t.Parallel()
+
+	tfvars := `
+fabrics = {
+  "data-fabric" = {
+    vlans = {
+      "internal" = { vid = 3403, subnets = { "internal" = { cidr = "10.0.7.0/24" } } }
+      "provider" = {
+        vid = 3409
+        subnets = {
+          "provider" = {
+            cidr                        = "192.0.2.0/28"
+            allow_dns                   = false
+            allow_proxy                 = false
+            managed                     = false
+            rdns_mode                   = 0
+            active_discovery            = true
+            disabled_boot_architectures = ["pxe"]
+          }
+        }
+      }
+    }
+  }
+}
+`
+	out, values, err := planModule(t, "maas-configure-networking", tfvars, map[string]string{
+		"subnet_options": `{
+    for key, subnet in local.subnets_map : key => {
+      allow_dns                   = subnet.allow_dns
+      allow_proxy                 = subnet.allow_proxy
+      rdns_mode                   = subnet.rdns_mode
+      managed                     = subnet.managed
+      active_discovery            = subnet.active_discovery
+      disabled_boot_architectures = subnet.disabled_boot_architectures
+    }
+  }`,
+	})
+	require.NoError(t, err, "Plan should succeed: %s", out)
+
+	assert.Equal(t, map[string]interface{}{
+		"data-fabric-3403-internal": map[string]interface{}{
+			"allow_dns":                   true,
+			"allow_proxy":                 true,
+			"rdns_mode":                   2.0,
+			"managed":                     true,
+			"active_discovery":            false,
+			"disabled_boot_architectures": []interface{}{},
+		},
+		"data-fabric-3409-provider": map[string]interface{}{
+			"allow_dns":                   false,
+			"allow_proxy":                 false,
+			"rdns_mode":                   0.0,
+			"managed":                     false,
+			"active_discovery":            true,
+			"disabled_boot_architectures": []interface{}{"pxe"},
+		},
+	}, values["subnet_options"], "Subnets without options should get the MAAS defaults, others keep theirs")
+
+	runValidationCases(t, "maas-configure-networking", []validationCase{
+		{
+			name:    "unknown rdns_mode",
+			tfvars:  `fabrics = { "f" = { vlans = { "100" = { subnets = { "s" = { cidr = "10.0.7.0/24", rdns_mode = 3 } } } } } }`,
+			wantErr: "Subnet rdns_mode must be 0 (disabled), 1 (enabled) or 2 (RFC2317).",
+		},
+	})
+}
+
+// TestMaasConfigureNetworkingVlanDHCP applies VLANs with rack-served and
+// relayed DHCP to a fake MAAS
+func TestMaasConfigureNetworkingVlanDHCP(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeMAAS(t)
+	primary := fake.AddRackController("maas-rack-1")
+	secondary := fake.AddRackController("maas-rack-2")
+	path, _ := fakeMAASCLI(t)
+
+	dynamicRange := func(start, end string) map[string]interface{} {
+		return map[string]interface{}{
+			"dhcp": map[string]interface{}{"start_ip": start, "end_ip": end, "type": "dynamic"},
+		}
+	}
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: fakeMAASModule(t, "../modules/maas-configure-networking", fake),
+		Vars: map[string]interface{}{
+			"maas_api_url": fake.URL + "/MAAS",
+			"maas_api_key": "consumer:token:secret",
+			"fabrics": map[string]interface{}{
+				"management-fabric": map[string]interface{}{
+					"vlans": map[string]interface{}{
+						"oam": map[string]interface{}{
+							"vid":            3400,
+							"dhcp_on":        true,
+							"primary_rack":   "maas-rack-1",
+							"secondary_rack": "maas-rack-2",
+							"subnets": map[string]interface{}{
+								"oam": map[string]interface{}{"cidr": "10.0.2.0/24", "reserved": dynamicRange("10.0.2.200", "10.0.2.254")},
+							},
+						},
+						"admin": map[string]interface{}{
+							"vid":        3402,
+							"relay_vlan": "management-fabric-oam",
+							"subnets": map[string]interface{}{
+								"admin": map[string]interface{}{"cidr": "10.0.3.0/24", "reserved": dynamicRange("10.0.3.200", "10.0.3.254")},
+							},
+						},
+					},
+				},
+			},
+		},
+		EnvVars: map[string]string{"PATH": path},
+		NoColor: true,
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	oam := fake.VLAN(3400)
+	require.NotNil(t, oam, "The OAM VLAN should be created")
+	assert.Equal(t, true, oam["dhcp_on"], "DHCP should be enabled on the OAM VLAN")
+	assert.Equal(t, primary, oam["primary_rack"], "The primary rack should be resolved to its system ID")
+	assert.Equal(t, secondary, oam["secondary_rack"], "The secondary rack should be resolved to its system ID")
+
+	admin := fake.VLAN(3402)
+	require.NotNil(t, admin, "The admin VLAN should be created")
+	assert.Equal(t, oam["id"], admin["relay_vlan"], "The admin VLAN should relay DHCP to the OAM VLAN")
+	assert.NotEqual(t, true, admin["dhcp_on"], "The relayed VLAN should not serve DHCP itself")
+
+	dhcpOutput := terraform.OutputMap(t, terraformOptions, "vlan_dhcp")
+	assert.Contains(t, dhcpOutput, "management-fabric-3400", "Should output rack-served DHCP")
+}
+
+// TestMaasConfigureNetworkingVlanDHCPPlan plans rack-served and relayed DHCP
+// against the module's variables and locals and checks the DHCP each VLAN
+// gets and the rack controllers looked up
+func TestMaasConfigureNetworkingVlanDHCPPlan(t *testing.T) {
+	t.Parallel()
+
+	tfvars := `
+fabrics = {
+  "management-fabric" = {
+    vlans = {
+      "oam" = {
+        vid            = 3400
+        dhcp_on        = true
+        primary_rack   = "maas-rack-1"
+        secondary_rack = "maas-rack-2"
+        subnets = { "oam" = { cidr = "10.0.2.0/24", reserved = { "dhcp" = { start_ip = "10.0.2.200", end_ip = "10.0.2.254", type = "dynamic" } } } }
+      }
+      "3402" = { relay_vlan = "management-fabric-oam", subnets = { "admin" = { cidr = "10.0.3.0/24" } } }
+      "3403" = { relay_vlan = "management-fabric-3400", subnets = { "internal" = { cidr = "10.0.7.0/24" } } }
+      "3404" = { subnets = { "public" = { cidr = "10.0.5.0/24" } } }
+    }
+  }
+}
+`
+	out, values, err := planModule(t, "maas-configure-networking", tfvars, map[string]string{
+		"vlan_dhcp": `{
+    for key, vlan in local.vlan_dhcp_map : key => vlan.relay_vlan == null ? "racks ${vlan.primary_rack} ${coalesce(vlan.secondary_rack, "-")}" : "relay ${local.vlan_keys[vlan.relay_vlan]}"
+  }`,
+		"rack_controllers": "local.rack_controllers",
+	})
+	require.NoError(t, err, "Plan should succeed: %s", out)
+
+	assert.Equal(t, map[string]interface{}{
+		"management-fabric-3400": "racks maas-rack-1 maas-rack-2",
+		"management-fabric-3402": "relay management-fabric-3400",
+		"management-fabric-3403": "relay management-fabric-3400",
+	}, values["vlan_dhcp"], "Relays by VLAN key or vid should resolve, and VLANs without DHCP settings be left alone")
+	assert.ElementsMatch(t, []interface{}{"maas-rack-1", "maas-rack-2"}, values["rack_controllers"], "Should look up each named rack controller")
+
+	dynamic := `subnets = { "oam" = { cidr = "10.0.2.0/24", reserved = { "dhcp" = { start_ip = "10.0.2.200", end_ip = "10.0.2.254", type = "dynamic" } } } }`
+	runValidationCases(t, "maas-configure-networking", []validationCase{
+		{
+			name:    "DHCP without a dynamic range",
+			tfvars:  `fabrics = { "f" = { vlans = { "100" = { dhcp_on = true, subnets = { "oam" = { cidr = "10.0.2.0/24" } } } } } }`,
+			wantErr: `VLANs with dhcp_on must have a reserved range of type "dynamic" in one of their subnets.`,
+		},
+		{
+			name:    "relay and serve",
+			tfvars:  `fabrics = { "f" = { vlans = { "100" = { dhcp_on = true, ` + dynamic + ` }, "200" = { dhcp_on = true, relay_vlan = "f-100", ` + dynamic + ` } } } }`,
+			wantErr: "A VLAN either relays DHCP (relay_vlan, without dhcp_on or racks) or serves it",
+		},
+		{
+			name:    "secondary without primary",
+			tfvars:  `fabrics = { "f" = { vlans = { "100" = { dhcp_on = true, secondary_rack = "maas-rack-2", ` + dynamic + ` } } } }`,
+			wantErr: "secondary_rack requires primary_rack.",
+		},
+		{
+			name:    "relay to a VLAN without DHCP",
+			tfvars:  `fabrics = { "f" = { vlans = { "100" = { subnets = {} }, "200" = { relay_vlan = "f-100", subnets = {} } } } }`,
+			wantErr: `relay_vlan must be "<fabric>-<vid>" or "<fabric>-<VLAN key>" of a VLAN in fabrics with dhcp_on.`,
+		},
+		{
+			name:    "relay to an unknown VLAN",
+			tfvars:  `fabrics = { "f" = { vlans = { "100" = { dhcp_on = true, ` + dynamic + ` }, "200" = { relay_vlan = "g-100", subnets = {} } } } }`,
+			wantErr: `relay_vlan must be "<fabric>-<vid>" or "<fabric>-<VLAN key>" of a VLAN in fabrics with dhcp_on.`,
+		},
+	})
+}
+
+// TestMaasConfigureNetworkingStaticRoutes applies static routes between named
+// subnets to a fake MAAS and checks the MAAS CLI gets their subnet IDs
+func TestMaasConfigureNetworkingStaticRoutes(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeMAAS(t)
+	path, cliLog := fakeMAASCLI(t)
+
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: fakeMAASModule(t, "../modules/maas-configure-networking", fake),
+		Vars: map[string]interface{}{
+			"maas_api_url": fake.URL + "/MAAS",
+			"maas_api_key": "consumer:token:secret",
+			"fabrics": map[string]interface{}{
+				"rack1-fabric": map[string]interface{}{
+					"vlans": map[string]interface{}{
+						"storage": map[string]interface{}{
+							"vid": 3405,
+							"subnets": map[string]interface{}{
+								"storage-rack1": map[string]interface{}{"cidr": "10.0.4.0/24"},
+							},
+						},
+					},
+				},
+				"rack2-fabric": map[string]interface{}{
+					"vlans": map[string]interface{}{
+						"storage": map[string]interface{}{
+							"vid": 3405,
+							"subnets": map[string]interface{}{
+								"storage-rack2": map[string]interface{}{"cidr": "10.1.4.0/24"},
+							},
+						},
+					},
+				},
+			},
+			"static_routes": map[string]interface{}{
+				"rack1-to-rack2-storage": map[string]interface{}{
+					"source":      "storage-rack1",
+					"destination": "rack2-fabric-3405-storage-rack2",
+					"gateway_ip":  "10.0.4.1",
+					"metric":      10,
+				},
+			},
+		},
+		// The destroy provisioner logs in with the key from the environment
+		EnvVars: map[string]string{"PATH": path, "TF_VAR_maas_api_key": "consumer:token:secret"},
+		NoColor: true,
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	source := fake.Subnet("10.0.4.0/24")
+	destination := fake.Subnet("10.1.4.0/24")
+	require.NotNil(t, source, "The rack 1 storage subnet should be created")
+	require.NotNil(t, destination, "The rack 2 storage subnet should be created")
+
+	cliCalls, err := os.ReadFile(cliLog)
+	require.NoError(t, err, "The MAAS CLI should be called")
+	route := fmt.Sprintf("static-routes create source=%v destination=%v gateway_ip=10.0.4.1 metric=10", source["id"], destination["id"])
+	assert.Contains(t, string(cliCalls), route, "Should create the route between the subnets' IDs")
+
+	subnetIDs := terraform.OutputMap(t, terraformOptions, "subnet_ids")
+	assert.Equal(t, fmt.Sprint(source["id"]), subnetIDs["storage-rack1"], "Should output subnet IDs by subnet name")
+	assert.Equal(t, fmt.Sprint(destination["id"]), subnetIDs["storage-rack2"], "Should output subnet IDs by subnet name")
+}
+
+// TestMaasConfigureNetworkingStaticRoutesPlan plans static routes against
+// the module's variables and locals and checks the subnets they resolve to
+func TestMaasConfigureNetworkingStaticRoutesPlan(t *testing.T) {
+	t.Parallel()
+
+	fabrics := `
+fabrics = {
+  "rack1-fabric" = { vlans = { "storage" = { vid = 3405, subnets = { "storage-rack1" = { cidr = "10.0.4.0/24" } } } } }
+  "rack2-fabric" = { vlans = { "storage" = { vid = 3405, subnets = { "storage-rack2" = { cidr = "10.1.4.0/24" } } } } }
+}
+`
+	out, values, err := planModule(t, "maas-configure-networking", fabrics+`
+static_routes = {
+  "by-name" = { source = "storage-rack1", destination = "storage-rack2", gateway_ip = "10.0.4.1" }
+  "by-key"  = { source = "rack2-fabric-3405-storage-rack2", destination = "storage-rack1", gateway_ip = "10.1.4.1", metric = 10 }
+  "unknown" = { source = "storage-rack1", destination = "storage-rack3", gateway_ip = "10.0.4.1" }
+}
+`, map[string]string{
+		"routes": `{
+    for name, route in local.static_routes_map : name => "${coalesce(route.source_key, "-")} > ${coalesce(route.destination_key, "-")} via ${route.gateway_ip} metric ${route.metric}"
+  }`,
+	})
+	require.NoError(t, err, "Plan should succeed: %s", out)
+
+	assert.Equal(t, map[string]interface{}{
+		"by-name": "rack1-fabric-3405-storage-rack1 > rack2-fabric-3405-storage-rack2 via 10.0.4.1 metric 0",
+		"by-key":  "rack2-fabric-3405-storage-rack2 > rack1-fabric-3405-storage-rack1 via 10.1.4.1 metric 10",
+		"unknown": "rack1-fabric-3405-storage-rack1 > - via 10.0.4.1 metric 0",
+	}, values["routes"], "Routes should resolve subnet names and keys, leaving unknown subnets for the precondition")
+
+	runValidationCases(t, "maas-configure-networking", []validationCase{
+		{
+			name:    "same subnet",
+			tfvars:  fabrics + `static_routes = { "loop" = { source = "storage-rack1", destination = "storage-rack1", gateway_ip = "10.0.4.1" } }`,
+			wantErr: "A static route's source and destination must be different subnets.",
+		},
+		{
+			name:    "malformed gateway",
+			tfvars:  fabrics + `static_routes = { "r" = { source = "storage-rack1", destination = "storage-rack2", gateway_ip = "10.0.4" } }`,
+			wantErr: "Static route gateway_ip must be an IPv4 or IPv6 address and metric must not be negative.",
+		},
+		{
+			name:    "negative metric",
+			tfvars:  fabrics + `static_routes = { "r" = { source = "storage-rack1", destination = "storage-rack2", gateway_ip = "10.0.4.1", metric = -1 } }`,
+			wantErr: "Static route gateway_ip must be an IPv4 or IPv6 address and metric must not be negative.",
+		},
+		{
+			name:   "valid",
+			tfvars: fabrics + `static_routes = { "r" = { source = "storage-rack1", destination = "storage-rack2", gateway_ip = "10.0.4.1", metric = 5 } }`,
+		},
+	})
+}
+
+// TestMaasConfigureNetworkingDualStack applies an IPv4 and an IPv6 subnet on
+// one VLAN to a fake MAAS and checks the IPv6 mode of each subnet
+func TestMaasConfigureNetworkingDualStack(t *testing.T) {
+	t.Parallel()
+
+	fake := newFakeMAAS(t)
+	path, _ := fakeMAASCLI(t)
+
+	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
+		TerraformDir: fakeMAASModule(t, "../modules/maas-configure-networking", fake),
+		Vars: map[string]interface{}{
+			"maas_api_url": fake.URL + "/MAAS",
+			"maas_api_key": "consumer:token:secret",
+			"fabrics": map[string]interface{}{
+				"management-fabric": map[string]interface{}{
+					"vlans": map[string]interface{}{
+						"oam": map[string]interface{}{
+							"vid":     3400,
+							"dhcp_on": true,
+							"subnets": map[string]interface{}{
+								"oam": map[string]interface{}{
+									"cidr":       "10.0.2.0/24",
+									"gateway_ip": "10.0.2.1",
+									"reserved": map[string]interface{}{
+										"dhcp": map[string]interface{}{"start_ip": "10.0.2.200", "end_ip": "10.0.2.254", "type": "dynamic"},
+									},
+								},
+								"oam-v6": map[string]interface{}{
+									"cidr":       "fd00:0:0:2::/64",
+									"gateway_ip": "fd00:0:0:2::1",
+									"reserved": map[string]interface{}{
+										"dhcp": map[string]interface{}{"start_ip": "fd00:0:0:2::100", "end_ip": "fd00:0:0:2::1ff", "type": "dynamic"},
+									},
+								},
+								"oam-v6-slaac": map[string]interface{}{
+									"cidr":       "fd00:0:0:3::/64",
+									"gateway_ip": "fd00:0:0:3::1",
+									"ipv6_mode":  "slaac",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		EnvVars: map[string]string{"PATH": path},
+		NoColor: true,
+	})
+
+	defer terraform.Destroy(t, terraformOptions)
+	terraform.InitAndApply(t, terraformOptions)
+
+	ipv4 := fake.Subnet("10.0.2.0/24")
+	ipv6 := fake.Subnet("fd00:0:0:2::/64")
+	require.NotNil(t, ipv4, "The IPv4 subnet should be created")
+	require.NotNil(t, ipv6, "The IPv6 subnet should be created")
+	assert.Equal(t, ipv4["vlan"].(map[string]interface{})["id"], ipv6["vlan"].(map[string]interface{})["id"], "Both subnets should be on the same VLAN")
+	assert.Equal(t, "fd00:0:0:2::1", ipv6["gateway_ip"], "The IPv6 gateway should be set")
+
+	subnets := terraform.OutputMapOfObjects(t, terraformOptions, "subnets")
+	assert.Equal(t, "dhcpv6", subnets["management-fabric-3400-oam-v6"].(map[string]interface{})["ipv6_mode"], "An IPv6 subnet with a dynamic range should use DHCPv6")
+	assert.Equal(t, "slaac", subnets["management-fabric-3400-oam-v6-slaac"].(map[string]interface{})["ipv6_mode"], "An IPv6 subnet without a dynamic range should use SLAAC")
+	assert.Nil(t, subnets["management-fabric-3400-oam"].(map[string]interface{})["ipv6_mode"], "IPv4 subnets have no IPv6 mode")
+}
+
+// TestMaasConfigureNetworkingDualStackPlan plans IPv4 and IPv6 subnets on one
+// VLAN and checks each subnet's IP version and IPv6 mode, and that IPv6
+// ranges are validated like IPv4 ones
+func TestMaasConfigureNetworkingDualStackPlan(t *testing.T) {
+	t.Parallel()
+
+	tfvars := `
+fabrics = {
+  "management-fabric" = {
+    vlans = {
+      "oam" = {
+        vid     = 3400
+        dhcp_on = true
+        subnets = {
+          "oam"          = { cidr = "10.0.2.0/24", gateway_ip = "10.0.2.1", reserved = { "dhcp" = { start_ip = "10.0.2.200", end_ip = "10.0.2.254", type = "dynamic" } } }
+          "oam-v6"       = { cidr = "fd00:0:0:2::/64", gateway_ip = "fd00:0:0:2::1", reserved = { "dhcp" = { start_ip = "fd00:0:0:2::100", end_ip = "fd00:0:0:2::1ff", type = "dynamic" } } }
+          "oam-v6-slaac" = { cidr = "fd00:0:0:3::/64", gateway_ip = "fd00:0:0:3::1", ipv6_mode = "slaac" }
+        }
+      }
+    }
+  }
+}
+`
+	out, values, err := planModule(t, "maas-configure-networking", tfvars, map[string]string{
+		"subnets": `{ for key, subnet in local.subnets_map : key => "${subnet.ip_version} ${coalesce(subnet.ipv6_mode, "-")}" }`,
+	})
+	require.NoError(t, err, "Plan should succeed: %s", out)
+
+	assert.Equal(t, map[string]interface{}{
+		"management-fabric-3400-oam":          "4 -",
+		"management-fabric-3400-oam-v6":       "6 dhcpv6",
+		"management-fabric-3400-oam-v6-slaac": "6 slaac",
+	}, values["subnets"], "IPv6 subnets with a dynamic range should use DHCPv6, others SLAAC; IPv4 subnets have no IPv6 mode")
+
+	ipv6 := func(dhcp bool, subnet string) string {
+		return fmt.Sprintf(`fabrics = { "f" = { vlans = { "100" = { dhcp_on = %t, subnets = { "v6" = %s } } } } }`, dhcp, subnet)
+	}
+	ranges := "Reserved ranges in a subnet must have start_ip <= end_ip and must not overlap, and dynamic ranges must not include the subnet's gateway_ip."
+	runValidationCases(t, "maas-configure-networking", []validationCase{
+		{
+			name: "ranges in the upper 64 bits",
+			// Apart only beyond 2^53, so the comparison must not go through floats
+			tfvars:  ipv6(false, `{ cidr = "fd00::/16", reserved = { "a" = { start_ip = "fd00:1::1", end_ip = "fd00:1::ff" }, "b" = { start_ip = "fd00:2::1", end_ip = "fd00:2::ff" } } }`),
+			wantErr: "",
+		},
+		{
+			name:    "overlapping IPv6 ranges",
+			tfvars:  ipv6(true, `{ cidr = "fd00:0:0:2::/64", reserved = { "dhcp" = { start_ip = "fd00:0:0:2::100", end_ip = "fd00:0:0:2::1ff", type = "dynamic" }, "vips" = { start_ip = "fd00:0:0:2::1f0", end_ip = "fd00:0:0:2::2ff" } } }`),
+			wantErr: ranges,
+		},
+		{
+			name:    "IPv6 range running backwards",
+			tfvars:  ipv6(false, `{ cidr = "fd00:0:0:2::/64", reserved = { "vips" = { start_ip = "fd00:0:0:2::2ff", end_ip = "fd00:0:0:2::200" } } }`),
+			wantErr: ranges,
+		},
+		{
+			name:    "IPv6 gateway inside the dynamic range",
+			tfvars:  ipv6(true, `{ cidr = "fd00:0:0:2::/64", gateway_ip = "fd00:0:0:2::150", reserved = { "dhcp" = { start_ip = "fd00:0:0:2::100", end_ip = "fd00:0:0:2::1ff", type = "dynamic" } } }`),
+			wantErr: ranges,
+		},
+		{
+			name:    "IPv6 range outside the CIDR",
+			tfvars:  ipv6(false, `{ cidr = "fd00:0:0:2::/64", reserved = { "vips" = { start_ip = "fd00:0:0:3::100", end_ip = "fd00:0:0:3::1ff" } } }`),
+			wantErr: "Subnet cidr must be a valid IPv4 or IPv6 CIDR, and gateway_ip and reserved range start_ip/end_ip must be addresses inside it.",
+		},
+		{
+			name:    "DHCPv6 without a dynamic range",
+			tfvars:  ipv6(true, `{ cidr = "fd00:0:0:2::/64", ipv6_mode = "dhcpv6" }`),
+			wantErr: "dhcpv6 subnets need a dynamic range and dhcp_on on their VLAN; slaac subnets must not have a dynamic range.",
+		},
+		{
+			name:    "IPv6 mode on an IPv4 subnet",
+			tfvars:  ipv6(false, `{ cidr = "10.0.2.0/24", ipv6_mode = "slaac" }`),
+			wantErr: `Subnet ipv6_mode must be "slaac" or "dhcpv6", and is only valid on IPv6 subnets.`,
+		},
+	})
+}
@@ -0,0 +1,159 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// vlanTfvars wraps subnets in a single dhcp_on VLAN, keyed by its vid
+func vlanTfvars(subnets string) string {
+	return `fabrics = { "fabric" = { vlans = { "100" = { dhcp_on = true, subnets = {` + subnets + `} } } } }`
+}
+
+var networkingValidationCases = []validationCase{
+	{
+		name: "valid dual-stack",
+		tfvars: vlanTfvars(`
+			"v4" = { cidr = "10.0.2.0/24", gateway_ip = "10.0.2.1", reserved = {
+				"gw"   = { start_ip = "10.0.2.1", end_ip = "10.0.2.9" }
+				"dhcp" = { start_ip = "10.0.2.200", end_ip = "10.0.2.254", type = "dynamic" }
+			} }
+			"v6" = { cidr = "fd00:0:0:2::/64", gateway_ip = "fd00:0:0:2::1", reserved = {
+				"gw"   = { start_ip = "fd00:0:0:2::1", end_ip = "fd00:0:0:2::9" }
+				"dhcp" = { start_ip = "fd00:0:0:2::1:0", end_ip = "fd00:0:0:2::1:ffff", type = "dynamic" }
+			} }`),
+	},
+	{
+		name:    "range type",
+		tfvars:  vlanTfvars(`"oam" = { cidr = "10.0.2.0/24", reserved = { "dhcp" = { start_ip = "10.0.2.200", end_ip = "10.0.2.254", type = "static" } } }`),
+		wantErr: `Reserved range type must be "reserved" or "dynamic".`,
+	},
+	{
+		name:    "range start outside CIDR",
+		tfvars:  vlanTfvars(`"oam" = { cidr = "10.0.2.0/24", reserved = { "dhcp" = { start_ip = "10.0.1.200", end_ip = "10.0.2.254", type = "dynamic" } } }`),
+		wantErr: "gateway_ip and reserved range start_ip/end_ip must be addresses inside it",
+	},
+	{
+		name:    "IPv6 range end outside CIDR",
+		tfvars:  vlanTfvars(`"oam" = { cidr = "fd00:0:0:2::/64", reserved = { "dhcp" = { start_ip = "fd00:0:0:2::100", end_ip = "fd00:0:0:3::1ff", type = "dynamic" } } }`),
+		wantErr: "gateway_ip and reserved range start_ip/end_ip must be addresses inside it",
+	},
+	{
+		name:    "gateway outside CIDR",
+		tfvars:  vlanTfvars(`"oam" = { cidr = "10.0.2.0/24", gateway_ip = "10.0.3.1", reserved = { "dhcp" = { start_ip = "10.0.2.200", end_ip = "10.0.2.254", type = "dynamic" } } }`),
+		wantErr: "gateway_ip and reserved range start_ip/end_ip must be addresses inside it",
+	},
+	{
+		name:    "malformed address",
+		tfvars:  vlanTfvars(`"oam" = { cidr = "10.0.2.0/24", reserved = { "dhcp" = { start_ip = "10.0.2.300", end_ip = "10.0.2.254", type = "dynamic" } } }`),
+		wantErr: "gateway_ip and reserved range start_ip/end_ip must be addresses inside it",
+	},
+	{
+		name:    "range backwards",
+		tfvars:  vlanTfvars(`"oam" = { cidr = "10.0.2.0/24", reserved = { "dhcp" = { start_ip = "10.0.2.254", end_ip = "10.0.2.200", type = "dynamic" } } }`),
+		wantErr: "must have start_ip <= end_ip and must not overlap",
+	},
+	{
+		name: "reserved range overlapping the dynamic range",
+		tfvars: vlanTfvars(`"oam" = { cidr = "10.0.2.0/24", reserved = {
+			"infra" = { start_ip = "10.0.2.10", end_ip = "10.0.2.210" }
+			"dhcp"  = { start_ip = "10.0.2.200", end_ip = "10.0.2.254", type = "dynamic" }
+		} }`),
+		wantErr: "must have start_ip <= end_ip and must not overlap",
+	},
+	{
+		name: "ranges share an address",
+		tfvars: vlanTfvars(`"oam" = { cidr = "10.0.2.0/24", reserved = {
+			"infra" = { start_ip = "10.0.2.10", end_ip = "10.0.2.15" }
+			"vip"   = { start_ip = "10.0.2.15", end_ip = "10.0.2.40" }
+			"dhcp"  = { start_ip = "10.0.2.200", end_ip = "10.0.2.254", type = "dynamic" }
+		} }`),
+		wantErr: "must have start_ip <= end_ip and must not overlap",
+	},
+	{
+		name: "IPv6 ranges overlap",
+		tfvars: vlanTfvars(`"oam" = { cidr = "fd00:0:0:2::/64", reserved = {
+			"infra" = { start_ip = "fd00:0:0:2::1", end_ip = "fd00:0:0:2::1:0" }
+			"dhcp"  = { start_ip = "fd00:0:0:2::ffff", end_ip = "fd00:0:0:2::1:ffff", type = "dynamic" }
+		} }`),
+		wantErr: "must have start_ip <= end_ip and must not overlap",
+	},
+	{
+		name:    "gateway inside dynamic range",
+		tfvars:  vlanTfvars(`"oam" = { cidr = "10.0.2.0/24", gateway_ip = "10.0.2.210", reserved = { "dhcp" = { start_ip = "10.0.2.200", end_ip = "10.0.2.254", type = "dynamic" } } }`),
+		wantErr: "dynamic ranges must not include the subnet's gateway_ip",
+	},
+	{
+		name:    "gateway at the end of dynamic range",
+		tfvars:  vlanTfvars(`"oam" = { cidr = "10.0.2.0/24", gateway_ip = "10.0.2.254", reserved = { "dhcp" = { start_ip = "10.0.2.200", end_ip = "10.0.2.254", type = "dynamic" } } }`),
+		wantErr: "dynamic ranges must not include the subnet's gateway_ip",
+	},
+	{
+		name:    "dhcp_on without dynamic range",
+		tfvars:  vlanTfvars(`"oam" = { cidr = "10.0.2.0/24", reserved = { "gw" = { start_ip = "10.0.2.1", end_ip = "10.0.2.9" } } }`),
+		wantErr: `VLANs with dhcp_on must have a reserved range of type "dynamic"`,
+	},
+	{
+		name:    "ipv6_mode on IPv4 subnet",
+		tfvars:  vlanTfvars(`"oam" = { cidr = "10.0.2.0/24", ipv6_mode = "slaac", reserved = { "dhcp" = { start_ip = "10.0.2.200", end_ip = "10.0.2.254", type = "dynamic" } } }`),
+		wantErr: "is only valid on IPv6 subnets",
+	},
+	{
+		name: "VLAN keyed by name without vid",
+		tfvars: `fabrics = { "fabric" = { vlans = {
+			"oam" = { subnets = { "oam" = { cidr = "10.0.2.0/24" } } }
+		} } }`,
+		wantErr: "VLANs keyed by name must set vid.",
+	},
+	{
+		name: "duplicate vid",
+		tfvars: `fabrics = { "management-fabric" = { vlans = {
+			"oam"  = { vid = 3400, subnets = { "oam" = { cidr = "10.0.2.0/24" } } }
+			"3400" = { subnets = { "admin" = { cidr = "10.0.3.0/24" } } }
+		} } }`,
+		wantErr: "Each vid can only be used once per fabric. Duplicates: management-fabric vid 3400 (3400, oam).",
+	},
+	{
+		name: "duplicate subnet name",
+		tfvars: `fabrics = {
+			"rack1-fabric" = { vlans = { "storage" = { vid = 3405, subnets = { "storage" = { cidr = "10.0.4.0/24" } } } } }
+			"rack2-fabric" = { vlans = { "storage" = { vid = 3405, subnets = { "storage" = { cidr = "10.1.4.0/24" } } } } }
+		}`,
+		wantErr: "Subnet names must be unique across fabrics. Duplicates: storage (rack1-fabric/storage, rack2-fabric/storage).",
+	},
+}
+
+// TestMaasConfigureNetworkingRangeValidation plans malformed networking
+// tfvars against the module's variables and checks each fails validation
+// before any resource (or API call) is planned
+func TestMaasConfigureNetworkingRangeValidation(t *testing.T) {
+	t.Parallel()
+
+	runValidationCases(t, "maas-configure-networking", networkingValidationCases)
+}
+
+// TestMaasConfigureNetworkingExampleValidation plans the prod networking
+// example and checks every subnet and range in it is planned
+func TestMaasConfigureNetworkingExampleValidation(t *testing.T) {
+	t.Parallel()
+
+	example, err := os.ReadFile("../clouds/prod/maas-configure-networking/networking.tfvars.example")
+	require.NoError(t, err, "Should be able to read networking.tfvars.example")
+
+	out, values, err := planModule(t, "maas-configure-networking", string(example), map[string]string{
+		"cidrs":     `[for subnet in values(local.subnets_map) : subnet.cidr]`,
+		"ipv6_mode": `{ for key, subnet in local.subnets_map : subnet.cidr => subnet.ipv6_mode if subnet.ip_version == 6 }`,
+		"ip_ranges": `length(local.ip_ranges_map)`,
+	})
+	require.NoError(t, err, "The example should pass validation: %s", out)
+
+	assert.ElementsMatch(t, []interface{}{
+		"10.0.2.0/24", "10.0.3.0/24", "10.0.8.0/24", "10.0.7.0/24", "fd00:0:0:7::/64",
+		"10.0.6.0/24", "10.0.5.0/24", "10.0.4.0/24", "192.0.2.0/28", "10.0.9.0/24",
+	}, values["cidrs"], "Every subnet of the example should be planned")
+	assert.Equal(t, map[string]interface{}{"fd00:0:0:7::/64": "slaac"}, values["ipv6_mode"], "The example's IPv6 subnet should use SLAAC")
+	assert.NotZero(t, values["ip_ranges"], "The example's reserved ranges should be planned")
+}
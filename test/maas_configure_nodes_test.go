@@ -399,3 +399,28 @@ func TestEmptyConfiguration(t *testing.T) {
 	// Should validate successfully with empty configuration
 	terraform.Init(t, terraformOptions)
 }
+
+// TestStaticIPAddressesIPv6 plans dual-stack static addresses against the
+// module's variables: IPv6 addresses inside their subnet pass validation,
+// malformed ones and ones outside their subnet fail it
+func TestStaticIPAddressesIPv6(t *testing.T) {
+	t.Parallel()
+
+	staticAddresses := func(ipv6 string) string {
+		return `nodes = {
+			"node1" = {
+				static_ip_addresses = {
+					"internal"    = { interface_name = "eth0", subnet_id = "10.0.7.0/24", ip_address = "10.0.7.21" }
+					"internal-v6" = { interface_name = "eth0", subnet_id = "fd00:0:0:7::/64", ip_address = "` + ipv6 + `" }
+				}
+			}
+		}`
+	}
+	const wantErr = "Static ip_address values must be IPv4 or IPv6 addresses, inside their subnet when subnet_id is a CIDR"
+
+	runValidationCases(t, "maas-configure-nodes-networking", []validationCase{
+		{name: "dual-stack", tfvars: staticAddresses("fd00:0:0:7::21")},
+		{name: "IPv6 outside subnet", tfvars: staticAddresses("fd00:0:0:8::21"), wantErr: wantErr},
+		{name: "malformed IPv6", tfvars: staticAddresses("fd00::7::21"), wantErr: wantErr},
+	})
+}
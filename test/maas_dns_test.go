@@ -0,0 +1,107 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMaasDnsDerivedRecords plans node and range records against the
+// module's variables and locals and checks the records they derive
+func TestMaasDnsDerivedRecords(t *testing.T) {
+	t.Parallel()
+
+	tfvars := `
+node_static_ip_addresses = {
+  "compute-1.maas" = [
+    { ip_address = "10.0.2.11", subnet_id = "oam" },
+    { ip_address = "fd00:0:0:2::11", subnet_id = "oam" },
+    { ip_address = "10.0.4.11", subnet_id = "ceph_access" },
+  ]
+}
+node_records = {
+  "oam" = { domain = "sunbeam.example.com", subnets = ["oam"] }
+}
+ip_ranges_by_subnet = {
+  "oam" = { "metallb" = { start_ip = "10.0.2.40", end_ip = "10.0.2.41", cidr = "10.0.2.0/24" } }
+}
+range_records = {
+  "metallb" = { subnet = "oam", range = "metallb", domain = "sunbeam.example.com", names = ["", "juju"] }
+  "short"   = { subnet = "oam", range = "metallb", domain = "sunbeam.example.com", names = ["a", "b", "c"] }
+  "missing" = { subnet = "oam", range = "vips", domain = "sunbeam.example.com", names = ["x"] }
+}
+`
+	out, values, err := planModule(t, "maas-dns", tfvars, map[string]string{
+		"records": `{ for k, r in local.records : k => "${r.name} ${r.type} ${coalesce(r.data, "-")}${r.problem == null ? "" : " (${r.problem})"}" }`,
+	})
+	require.NoError(t, err, "Plan should succeed: %s", out)
+
+	assert.Equal(t, map[string]interface{}{
+		// Node records on the oam subnet only, AAAA for IPv6
+		"oam/compute-1.maas/10.0.2.11":      "compute-1 A 10.0.2.11",
+		"oam/compute-1.maas/fd00:0:0:2::11": "compute-1 AAAA fd00:0:0:2::11",
+		// "" skips the first address of the range
+		"metallb/juju": "juju A 10.0.2.41",
+		"short/a":      "a A 10.0.2.40",
+		"short/b":      "b A 10.0.2.41",
+		"short/c":      "c A 10.0.2.42 (range metallb of subnet oam has fewer addresses than names)",
+		"missing/x":    "x A - (range vips of subnet oam is not in ip_ranges_by_subnet)",
+	}, values["records"], "Should derive one record per node address and range name")
+}
+
+// TestMaasDnsValidation plans DNS tfvars against the module's variables and
+// checks malformed records fail validation
+func TestMaasDnsValidation(t *testing.T) {
+	t.Parallel()
+
+	example, err := os.ReadFile("../clouds/prod/maas-dns/dns.tfvars.example")
+	require.NoError(t, err, "Should be able to read dns.tfvars.example")
+
+	runValidationCases(t, "maas-dns", []validationCase{
+		{
+			name:    "bad type",
+			tfvars:  `records = { "x" = { domain = "maas", name = "x", type = "MX", data = "10 mail" } }`,
+			wantErr: "Record type must be one of: A, AAAA, CNAME, SRV, TXT.",
+		},
+		{
+			name:    "A with IPv6",
+			tfvars:  `records = { "x" = { domain = "maas", name = "x", type = "A", data = "fd00::1" } }`,
+			wantErr: "A records need an IPv4 address and AAAA records an IPv6 address as data.",
+		},
+		{
+			name:    "SRV without service name",
+			tfvars:  `records = { "x" = { domain = "maas", name = "ldap", type = "SRV", data = "10 5 389 ldap.maas" } }`,
+			wantErr: "SRV records need a name like \"_service._proto\"",
+		},
+		{
+			name:    "duplicate range names",
+			tfvars:  `range_records = { "x" = { subnet = "oam", range = "metallb", domain = "maas", names = ["vip", "", "vip"] } }`,
+			wantErr: "Range record names must be unique within a set.",
+		},
+		{
+			name: "valid",
+			tfvars: `records = {
+				"a"   = { domain = "maas", name = "a", type = "A", data = "10.0.0.1" }
+				"srv" = { domain = "maas", name = "_ldap._tcp", type = "SRV", data = "10 5 389 ldap.maas" }
+			}`,
+		},
+		{name: "example", tfvars: string(example)},
+	})
+}
+
+// TestMaasDnsTerragruntUnit tests the prod unit takes its domains and record
+// sources from the units that own them
+func TestMaasDnsTerragruntUnit(t *testing.T) {
+	t.Parallel()
+
+	content, err := os.ReadFile("../clouds/prod/maas-dns/terragrunt.hcl")
+	require.NoError(t, err, "Should be able to read terragrunt.hcl")
+
+	contentStr := string(content)
+	assert.Contains(t, contentStr, "../../../modules/maas-dns\"", "Should source the local module")
+	assert.Contains(t, contentStr, "dependency.maas_config.outputs.domains", "Should take the domains from maas-config")
+	assert.Contains(t, contentStr, "dependency.networking.outputs.ip_ranges_by_subnet", "Should take reserved ranges from networking")
+	assert.Contains(t, contentStr, "dependency.nodes.outputs.static_ip_addresses", "Should take node static IPs from maas-configure-nodes")
+}
@@ -1,10 +1,12 @@
 package test
 
 import (
+	"os"
 	"testing"
 
 	"github.com/gruntwork-io/terratest/modules/terraform"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestMaasEnlistMachinesModule tests the maas-enlist-machines module
@@ -18,7 +20,7 @@ func TestMaasEnlistMachinesModule(t *testing.T) {
 	// This test requires MAAS_API_URL and MAAS_API_KEY environment variables
 	// Run with: go test -v -run TestMaasEnlistMachinesModule (not in short mode)
 	t.Skip("Integration test - requires MAAS server")
-}// TestMaasEnlistMachinesModuleValidation tests input validation
+} // TestMaasEnlistMachinesModuleValidation tests input validation
 func TestMaasEnlistMachinesModuleValidation(t *testing.T) {
 	t.Parallel()
 
@@ -26,16 +28,18 @@ func TestMaasEnlistMachinesModuleValidation(t *testing.T) {
 	terraformOptions := terraform.WithDefaultRetryableErrors(t, &terraform.Options{
 		TerraformDir: "../modules/maas-enlist-machines",
 		Vars: map[string]interface{}{
-			"machines": []interface{}{
-				map[string]interface{}{
-					"hostname":   "validation-test",
-					"power_type": "ipmi",
-					"power_parameters": map[string]interface{}{
-						"power_address": "10.0.0.100",
-						"power_user":    "admin",
-						"power_pass":    "password",
-					},
-					"pxe_mac_address": "aa:bb:cc:dd:ee:ff",
+			"machines": map[string]interface{}{
+				"validation-test": map[string]interface{}{
+					"power_type":        "ipmi",
+					"power_address":     "10.0.0.100",
+					"power_credentials": "rack1",
+					"pxe_mac_address":   "aa:bb:cc:dd:ee:ff",
+				},
+			},
+			"bmc_credentials": map[string]interface{}{
+				"rack1": map[string]interface{}{
+					"power_user": "admin",
+					"power_pass": "password",
 				},
 			},
 		},
@@ -60,7 +64,7 @@ func TestMaasEnlistMachinesModuleMultipleMachines(t *testing.T) {
 
 	// Verify module has the main.tf file for machines
 	assert.FileExists(t, "../modules/maas-enlist-machines/main.tf", "Module should have main.tf")
-}// TestMaasEnlistMachinesModuleOutputs tests module outputs are defined
+} // TestMaasEnlistMachinesModuleOutputs tests module outputs are defined
 func TestMaasEnlistMachinesModuleOutputs(t *testing.T) {
 	t.Parallel()
 
@@ -75,3 +79,142 @@ func TestMaasEnlistMachinesModuleOutputs(t *testing.T) {
 	// Verify module has expected output definitions
 	assert.FileExists(t, "../modules/maas-enlist-machines/outputs.tf", "Module should have outputs.tf")
 }
+
+// TestMaasEnlistMachinesCredentialsFromSecrets plans the example machines
+// with the example credentials file and checks every machine resolves its BMC
+// credentials from it rather than from machines.tfvars
+func TestMaasEnlistMachinesCredentialsFromSecrets(t *testing.T) {
+	t.Parallel()
+
+	content, err := os.ReadFile("../clouds/prod/maas-enlist-machines/terragrunt.hcl")
+	require.NoError(t, err, "Should be able to read terragrunt.hcl")
+
+	contentStr := string(content)
+	assert.Contains(t, contentStr, "bmc-credentials.json", "Should read credentials from a secrets file")
+	assert.Contains(t, contentStr, "BMC_CREDENTIALS_JSON", "Should read credentials from the environment")
+	assert.Contains(t, contentStr, "bmc_credentials = local.bmc_credentials", "Should pass credentials as an input")
+
+	example, err := os.ReadFile("../clouds/prod/maas-enlist-machines/machines.tfvars.example")
+	require.NoError(t, err, "Should be able to read machines.tfvars.example")
+	assert.NotContains(t, string(example), "power_pass", "Example should not contain BMC passwords")
+	credentials, err := os.ReadFile("../clouds/prod/maas-enlist-machines/bmc-credentials.json.example")
+	require.NoError(t, err, "Should be able to read bmc-credentials.json.example")
+
+	out, values, err := planModule(t, "maas-enlist-machines", string(example)+"\nbmc_credentials = "+string(credentials), map[string]string{
+		"users": `{ for k, c in local.power_credentials : k => coalesce(c.power_user, "-") }`,
+	})
+	require.NoError(t, err, "The examples should plan together: %s", out)
+	assert.Equal(t, map[string]interface{}{
+		"compute-01": "admin",
+		"compute-02": "admin",
+		"storage-01": "-",
+		"vm-test-01": "-",
+	}, values["users"], "IPMI machines should take their user from the credentials file")
+}
+
+// TestMaasEnlistMachinesModulePushPowerParameters plans machines with named
+// and inline credentials and checks the power parameters and revisions that
+// trigger a push of rotated credentials
+func TestMaasEnlistMachinesModulePushPowerParameters(t *testing.T) {
+	t.Parallel()
+
+	tfvars := `
+machines = {
+  "named"  = { power_type = "ipmi", power_address = "10.0.0.1", power_credentials = "rack1", power_driver = "LAN_2_0", pxe_mac_address = "aa:bb:cc:dd:ee:01" }
+  "inline" = { power_type = "ipmi", power_address = "10.0.0.2", power_user = "root", power_pass = "inline", pxe_mac_address = "aa:bb:cc:dd:ee:02" }
+}
+bmc_credentials = {
+  "rack1" = { power_user = "admin", power_pass = "secret", revision = "2024-06-01" }
+  "rack2" = { power_user = "maas", power_pass = "other" }
+}
+push_power_parameters = true
+`
+	out, values, err := planModule(t, "maas-enlist-machines", tfvars, map[string]string{
+		"power_parameters":     `{ for k, p in local.power_parameters : k => jsondecode(p) }`,
+		"credential_revisions": `local.credential_revisions`,
+	})
+	require.NoError(t, err, "Plan should succeed: %s", out)
+
+	parameters := values["power_parameters"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{
+		"power_address":   "10.0.0.1",
+		"power_user":      "admin",
+		"power_pass":      "secret",
+		"power_driver":    "LAN_2_0",
+		"power_boot_type": nil,
+		"cipher_suite_id": nil,
+	}, parameters["named"], "Named credentials should come from bmc_credentials")
+	assert.Equal(t, "inline", parameters["inline"].(map[string]interface{})["power_pass"], "Machines without power_credentials should use their own")
+	assert.Equal(t, map[string]interface{}{"rack1": "2024-06-01", "rack2": nil}, values["credential_revisions"],
+		"Revisions should be readable as push triggers")
+
+	runValidationCases(t, "maas-enlist-machines", []validationCase{
+		{
+			name:    "credentials without password",
+			tfvars:  `bmc_credentials = { "rack1" = { power_user = "admin" } }`,
+			wantErr: `attribute "power_pass" is required`,
+		},
+		{
+			name:    "push flag",
+			tfvars:  `push_power_parameters = "sometimes"`,
+			wantErr: "a bool is required",
+		},
+	})
+}
+
+// TestMaasEnlistMachinesModuleBulkOutputs plans a machines map and checks the
+// zone and pool groupings are taken from the inputs, with unset zones and
+// pools in MAAS's "default"
+func TestMaasEnlistMachinesModuleBulkOutputs(t *testing.T) {
+	t.Parallel()
+
+	tfvars := `
+machines = {
+  "compute-1" = { power_type = "manual", power_address = "", pxe_mac_address = "aa:bb:cc:dd:ee:01", zone = "az1", pool = "compute" }
+  "compute-2" = { power_type = "manual", power_address = "", pxe_mac_address = "aa:bb:cc:dd:ee:02", zone = "az2", pool = "compute" }
+  "storage-1" = { power_type = "manual", power_address = "", pxe_mac_address = "aa:bb:cc:dd:ee:03", zone = "az1" }
+  "spare"     = { power_type = "manual", power_address = "", pxe_mac_address = "aa:bb:cc:dd:ee:04" }
+}
+`
+	out, values, err := planModule(t, "maas-enlist-machines", tfvars, map[string]string{
+		"machines_by_zone": "local.machines_by_zone",
+		"machines_by_pool": "local.machines_by_pool",
+	})
+	require.NoError(t, err, "Plan should succeed: %s", out)
+
+	assert.Equal(t, map[string]interface{}{
+		"az1":     []interface{}{"compute-1", "storage-1"},
+		"az2":     []interface{}{"compute-2"},
+		"default": []interface{}{"spare"},
+	}, values["machines_by_zone"], "Machines should be grouped by their zone")
+	assert.Equal(t, map[string]interface{}{
+		"compute": []interface{}{"compute-1", "compute-2"},
+		"default": []interface{}{"spare", "storage-1"},
+	}, values["machines_by_pool"], "Machines should be grouped by their pool")
+
+	example, err := os.ReadFile("../clouds/prod/maas-enlist-machines/machines.tfvars.example")
+	require.NoError(t, err, "Should be able to read machines.tfvars.example")
+
+	runValidationCases(t, "maas-enlist-machines", []validationCase{
+		{
+			name:    "missing PXE MAC",
+			tfvars:  `machines = { "node" = { power_type = "manual", power_address = "" } }`,
+			wantErr: `attribute "pxe_mac_address" is required`,
+		},
+		{name: "example", tfvars: string(example)},
+	})
+}
+
+// TestMaasEnlistMachinesTerragruntUsesModule tests the unit sources the module instead of generating code
+func TestMaasEnlistMachinesTerragruntUsesModule(t *testing.T) {
+	t.Parallel()
+
+	content, err := os.ReadFile("../clouds/prod/maas-enlist-machines/terragrunt.hcl")
+	require.NoError(t, err, "Should be able to read terragrunt.hcl")
+
+	contentStr := string(content)
+	assert.Contains(t, contentStr, "modules/maas-enlist-machines", "Should source the enlist module")
+	assert.NotContains(t, contentStr, "generate \"main\"", "Should not generate module blocks")
+	assert.NoFileExists(t, "../clouds/prod/maas-enlist-machines/variables.tf",
+		"Variables should be declared by the module")
+}
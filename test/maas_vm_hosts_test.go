@@ -0,0 +1,92 @@
+package test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMaasVmHostsModuleValidation plans VM hosts against the module's
+// variables and checks invalid hosts and cluster members fail validation
+func TestMaasVmHostsModuleValidation(t *testing.T) {
+	t.Parallel()
+
+	example, err := os.ReadFile("../clouds/prod/maas-vm-hosts/vm-hosts.tfvars.example")
+	require.NoError(t, err, "Should be able to read vm-hosts.tfvars.example")
+
+	runValidationCases(t, "maas-vm-hosts", []validationCase{
+		{
+			name:   "lxd cluster",
+			tfvars: `vm_hosts = { "infra-1" = { type = "lxd", power_address = "10.10.0.11:8443", cluster_members = ["infra-2"] } }`,
+		},
+		{
+			name:    "virsh cluster",
+			tfvars:  `vm_hosts = { "kvm" = { type = "virsh", power_address = "qemu+ssh://ubuntu@10.10.0.20/system", cluster_members = ["kvm-2"] } }`,
+			wantErr: "cluster_members and project are only supported for lxd VM hosts.",
+		},
+		{
+			name: "duplicate member",
+			tfvars: `vm_hosts = {
+				"infra-1" = { type = "lxd", power_address = "10.10.0.11:8443", cluster_members = ["infra-2"] }
+				"infra-2" = { type = "lxd", power_address = "10.10.0.12:8443" }
+			}`,
+			wantErr: "VM host and cluster member names must be unique.",
+		},
+		{
+			name:    "no endpoint",
+			tfvars:  `vm_hosts = { "infra-1" = { type = "lxd" } }`,
+			wantErr: "Each VM host needs exactly one of power_address or machine.",
+		},
+		{name: "example", tfvars: string(example)},
+	})
+}
+
+// TestMaasVmHostsModuleResources tests LXD/virsh registration, cluster members and host settings
+func TestMaasVmHostsModuleResources(t *testing.T) {
+	t.Parallel()
+
+	content, err := os.ReadFile("../modules/maas-vm-hosts/main.tf")
+	require.NoError(t, err, "Should be able to read main.tf")
+
+	contentStr := string(content)
+	assert.Contains(t, contentStr, "resource \"maas_vm_host\" \"vm_host\"", "Should register VM hosts")
+	assert.Contains(t, contentStr, "data \"maas_vm_host\" \"cluster_member\"", "Should look up LXD cluster members")
+	assert.Contains(t, contentStr, "cpu_over_commit_ratio    = each.value.cpu_over_commit_ratio", "Should set the CPU overcommit ratio")
+	assert.Contains(t, contentStr, "default_storage_pool", "Should set the default storage pool")
+	assert.Contains(t, contentStr, "vm-host update", "Should update settings maas_vm_host does not manage")
+
+	variables, err := os.ReadFile("../modules/maas-vm-hosts/variables.tf")
+	require.NoError(t, err, "Should be able to read variables.tf")
+	variablesStr := string(variables)
+	assert.Contains(t, variablesStr, "[\"lxd\", \"virsh\"]", "Should validate the VM host type")
+	assert.Contains(t, variablesStr, "exactly one of power_address or machine", "Should require one endpoint")
+
+	outputs, err := os.ReadFile("../modules/maas-vm-hosts/outputs.tf")
+	require.NoError(t, err, "Should be able to read outputs.tf")
+	assert.Contains(t, string(outputs), "output \"vm_hosts\"", "Should output VM host IDs keyed by name")
+}
+
+// TestMaasVmHostsTerragruntUnit tests the unit and its place between maas-config and maas-compose-vms
+func TestMaasVmHostsTerragruntUnit(t *testing.T) {
+	t.Parallel()
+
+	content, err := os.ReadFile("../clouds/prod/maas-vm-hosts/terragrunt.hcl")
+	require.NoError(t, err, "Should be able to read terragrunt.hcl")
+
+	contentStr := string(content)
+	assert.Contains(t, contentStr, "../../../modules/maas-vm-hosts\"", "Should source the local module")
+	assert.Contains(t, contentStr, "config_path = \"../maas-config\"", "Should depend on maas-config")
+	assert.Contains(t, contentStr, "VM_HOST_CREDENTIALS_JSON", "Should read credentials outside tfvars")
+	assert.FileExists(t, "../clouds/prod/maas-vm-hosts/vm-hosts.tfvars.example", "Example configuration should exist")
+
+	// Mocks are only for planning before maas-vm-hosts is applied; skip_outputs
+	// would always pass the mocks, so compose would never see the real hosts
+	compose := parseTerragruntUnit(t, "maas-compose-vms")
+	dep, ok := compose.Dependencies["maas_vm_hosts"]
+	require.True(t, ok, "maas-compose-vms should depend on maas-vm-hosts")
+	assert.Equal(t, "../maas-vm-hosts", dep.ConfigPath)
+	assert.False(t, dep.SkipOutputs, "maas-compose-vms should read the real outputs of maas-vm-hosts")
+	assert.Equal(t, []string{"init", "validate", "plan"}, dep.MockCommands, "Mocks should only be used before maas-vm-hosts is applied")
+}
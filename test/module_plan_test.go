@@ -0,0 +1,156 @@
+package test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// validationCase is a tfvars file and the validation error it should fail
+// with ("" for tfvars that should pass).
+type validationCase struct {
+	name    string
+	tfvars  string
+	wantErr string
+}
+
+// topLevelBlock matches the first line of a top-level block of a
+// terraform fmt formatted file, e.g. `variable "nodes" {` or `locals {`
+var topLevelBlock = regexp.MustCompile(`^(variable|locals)\b.*\{$`)
+
+// objectReference matches a reference to a data source, module or resource,
+// e.g. `data.maas_vm_host.vm_host` or `maas_instance.vm[k]`
+var objectReference = regexp.MustCompile(`(^|[^.\w])(data|module|null_resource|maas_\w+)\.\w`)
+
+// moduleBlocks returns the variable (and with locals, the locals) blocks of
+// every .tf file of a module, which need no provider to evaluate. Locals
+// blocks referencing data sources, modules or resources are left out.
+func moduleBlocks(t *testing.T, module string, locals bool) string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join("..", "modules", module, "*.tf"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files, "module %s should have .tf files", module)
+
+	var b strings.Builder
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		require.NoError(t, err)
+		var block strings.Builder
+		references := false
+		for _, line := range strings.Split(string(content), "\n") {
+			if block.Len() == 0 {
+				if m := topLevelBlock.FindStringSubmatch(line); m == nil || (m[1] == "locals" && !locals) {
+					continue
+				}
+			}
+			block.WriteString(line + "\n")
+			code, _, _ := strings.Cut(line, "#")
+			references = references || objectReference.MatchString(code)
+			if line == "}" {
+				if !strings.HasPrefix(block.String(), "locals") || !references {
+					b.WriteString(block.String())
+				}
+				block.Reset()
+				references = false
+			}
+		}
+	}
+	return b.String()
+}
+
+// planModule plans tfvars against a provider-free copy of a module: its
+// variables and, when outputs are given, its locals with an output for each
+// expression (e.g. "local.vlans_map"). Variable validations and derived
+// values are evaluated without any provider or MAAS API call. Outputs are
+// sensitive, so they may hold credentials; the saved plan still has their
+// values. It returns the plan output and the planned output values.
+func planModule(t *testing.T, module, tfvars string, outputs map[string]string) (string, map[string]interface{}, error) {
+	t.Helper()
+	return planModuleWithLocals(t, module, "", tfvars, outputs)
+}
+
+// planModuleWithLocals is planModule with stubs for the locals the module
+// derives from data sources, e.g. `vm_host_zones = { "vmhost-1" = "az-1" }`,
+// standing in for what MAAS would return.
+func planModuleWithLocals(t *testing.T, module, locals, tfvars string, outputs map[string]string) (string, map[string]interface{}, error) {
+	t.Helper()
+	dir := t.TempDir()
+
+	config := moduleBlocks(t, module, len(outputs) > 0)
+	if locals != "" {
+		config += fmt.Sprintf("\nlocals {\n%s\n}\n", locals)
+	}
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		config += fmt.Sprintf("\noutput %q {\n  value     = %s\n  sensitive = true\n}\n", name, outputs[name])
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(config), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "test.tfvars"), []byte(tfvars), 0o644))
+
+	vars := map[string]interface{}{}
+	for name, value := range map[string]string{"maas_api_url": "http://localhost:5240/MAAS", "maas_api_key": "test:consumer:secret"} {
+		if strings.Contains(config, fmt.Sprintf("variable %q", name)) {
+			vars[name] = value
+		}
+	}
+	options := &terraform.Options{
+		TerraformDir: dir,
+		VarFiles:     []string{filepath.Join(dir, "test.tfvars")},
+		Vars:         vars,
+		PlanFilePath: filepath.Join(dir, "tfplan"),
+		NoColor:      true,
+	}
+	out, err := terraform.InitAndPlanE(t, options)
+	if err != nil {
+		return out, nil, err
+	}
+	plan, err := terraform.ShowWithStructE(t, options)
+	if err != nil {
+		return out, nil, err
+	}
+	values := map[string]interface{}{}
+	for name, output := range plan.RawPlan.PlannedValues.Outputs {
+		values[name] = output.Value
+	}
+	return out, values, nil
+}
+
+// runValidationCases plans each case against the module's variables and
+// checks it passes or fails with the expected validation error.
+func runValidationCases(t *testing.T, module string, cases []validationCase) {
+	t.Helper()
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			out, _, err := planModule(t, module, tc.tfvars, nil)
+			if tc.wantErr == "" {
+				assert.NoError(t, err, "tfvars should pass validation: %s", out)
+				return
+			}
+			require.Error(t, err, "tfvars should fail validation")
+			assert.Contains(t, normalizeTerraformOutput(out), tc.wantErr, "Should fail with the expected validation error")
+		})
+	}
+}
+
+var terraformOutputBorder = regexp.MustCompile(`(?m)^[│╷╵]\s?`)
+
+// normalizeTerraformOutput joins Terraform's wrapped, boxed error lines so
+// messages can be matched whole
+func normalizeTerraformOutput(out string) string {
+	return strings.Join(strings.Fields(terraformOutputBorder.ReplaceAllString(out, "")), " ")
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/stretchr/testify/require"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// terragruntDependency is a dependency block of a terragrunt.hcl.
+// MockCommands are its mock_outputs_allowed_terraform_commands.
+type terragruntDependency struct {
+	ConfigPath   string
+	SkipOutputs  bool
+	MockCommands []string
+}
+
+// terragruntUnit is what the tests check of a unit's terragrunt.hcl: its
+// module source, dependencies by name and inputs as expression source, e.g.
+// "dependency.maas_config.outputs.domains".
+type terragruntUnit struct {
+	Source       string
+	Dependencies map[string]terragruntDependency
+	Inputs       map[string]string
+}
+
+// parseTerragruntUnit parses clouds/prod/<unit>/terragrunt.hcl
+func parseTerragruntUnit(t *testing.T, unit string) terragruntUnit {
+	t.Helper()
+	filename := filepath.Join("..", "clouds", "prod", unit, "terragrunt.hcl")
+	src, err := os.ReadFile(filename)
+	require.NoError(t, err)
+	file, diags := hclsyntax.ParseConfig(src, filename, hcl.InitialPos)
+	require.False(t, diags.HasErrors(), "%s should parse: %s", filename, diags)
+	body := file.Body.(*hclsyntax.Body)
+
+	parsed := terragruntUnit{Dependencies: map[string]terragruntDependency{}, Inputs: map[string]string{}}
+	for _, block := range body.Blocks {
+		switch {
+		case block.Type == "terraform":
+			if attr, ok := block.Body.Attributes["source"]; ok {
+				parsed.Source = literal(t, attr).AsString()
+			}
+		case block.Type == "dependency" && len(block.Labels) == 1:
+			var dep terragruntDependency
+			if attr, ok := block.Body.Attributes["config_path"]; ok {
+				dep.ConfigPath = literal(t, attr).AsString()
+			}
+			if attr, ok := block.Body.Attributes["skip_outputs"]; ok {
+				dep.SkipOutputs = literal(t, attr).True()
+			}
+			if attr, ok := block.Body.Attributes["mock_outputs_allowed_terraform_commands"]; ok {
+				for _, command := range literal(t, attr).AsValueSlice() {
+					dep.MockCommands = append(dep.MockCommands, command.AsString())
+				}
+			}
+			parsed.Dependencies[block.Labels[0]] = dep
+		}
+	}
+
+	if attr, ok := body.Attributes["inputs"]; ok {
+		object, ok := attr.Expr.(*hclsyntax.ObjectConsExpr)
+		require.True(t, ok, "%s inputs should be an object", filename)
+		for _, item := range object.Items {
+			key := hcl.ExprAsKeyword(item.KeyExpr)
+			require.NotEmpty(t, key, "%s inputs should be keyed by name", filename)
+			parsed.Inputs[key] = string(item.ValueExpr.Range().SliceBytes(src))
+		}
+	}
+	return parsed
+}
+
+// literal evaluates an attribute that needs no functions or variables
+func literal(t *testing.T, attr *hclsyntax.Attribute) cty.Value {
+	t.Helper()
+	value, diags := attr.Expr.Value(nil)
+	require.False(t, diags.HasErrors(), "%s should be a literal: %s", attr.Name, diags)
+	return value
+}
@@ -0,0 +1,83 @@
+// Command maas-block-devices describes the disks of a MAAS machine in the
+// order they were created.
+//
+// It runs as a Terraform external data source, so that storage layouts can
+// be applied to composed VMs whose disks are only known once they exist:
+//
+//	{"machine": "abc123"}
+//
+// The result describes every physical block device, ordered by ID (the
+// order MAAS composed them in), as "<index>.<field>" keys:
+//
+//	{"count": "2", "0.name": "sda", "0.id_path": "", "0.model": "QEMU HARDDISK", "0.serial": "lxd_root", "0.size_gigabytes": "20", ...}
+//
+// The MAAS API URL and key are read from MAAS_API_URL and MAAS_API_KEY,
+// falling back to the TF_VAR_maas_api_url and TF_VAR_maas_api_key inputs
+// Terragrunt exports to Terraform.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+
+	"github.com/hemanthnakkina/sunbeam-maas/tools/internal/external"
+	"github.com/hemanthnakkina/sunbeam-maas/tools/internal/maas"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("maas-block-devices: ")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Stdin, os.Stdout); err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, stdin io.Reader, stdout io.Writer) error {
+	query, err := external.ReadQuery(stdin)
+	if err != nil {
+		return err
+	}
+	if query["machine"] == "" {
+		return errors.New("query machine is empty")
+	}
+
+	client, err := maas.NewClientFromEnv()
+	if err != nil {
+		return err
+	}
+	devices, err := client.BlockDevices(ctx, query["machine"])
+	if err != nil {
+		return fmt.Errorf("listing block devices of %s: %w", query["machine"], err)
+	}
+
+	var physical []maas.BlockDevice
+	for _, d := range devices {
+		if d.Type == "physical" {
+			physical = append(physical, d)
+		}
+	}
+	sort.Slice(physical, func(i, j int) bool { return physical[i].ID < physical[j].ID })
+
+	result := map[string]string{"count": strconv.Itoa(len(physical))}
+	for i, d := range physical {
+		prefix := strconv.Itoa(i) + "."
+		result[prefix+"name"] = d.Name
+		result[prefix+"id_path"] = d.IDPath
+		result[prefix+"model"] = d.Model
+		result[prefix+"serial"] = d.Serial
+		result[prefix+"size_gigabytes"] = strconv.FormatInt(d.Size/1e9, 10)
+	}
+	return external.WriteResult(stdout, result)
+}
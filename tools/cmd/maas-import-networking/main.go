@@ -0,0 +1,113 @@
+// Command maas-import-networking writes Terraform import blocks adopting
+// existing MAAS spaces, fabrics, VLANs, subnets and IP ranges into the
+// maas-configure-networking unit, so deployments whose networking already
+// exists (e.g. discovered when rack controllers registered) are onboarded
+// without recreating it.
+//
+// It reads the declared networking from a plan of the unit and the existing
+// networking from JSON saved with the MAAS CLI:
+//
+//	terragrunt plan -out tfplan && terragrunt show -json tfplan > plan.json
+//	maas admin fabrics read > fabrics.json
+//	maas admin subnets read > subnets.json
+//	maas admin spaces read > spaces.json
+//	maas admin ipranges read > ipranges.json
+//	maas-import-networking -plan plan.json -fabrics fabrics.json -subnets subnets.json \
+//		-spaces spaces.json -ipranges ipranges.json -o imports.tf
+//
+// Subnets are matched by CIDR, VLANs by vid and fabrics by name or by the
+// subnets they hold; the spaces and IP ranges files are optional. What the
+// imports will change, and what cannot be adopted, is reported on stderr.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/hemanthnakkina/sunbeam-maas/tools/internal/adopt"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("maas-import-networking: ")
+
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("maas-import-networking", flag.ContinueOnError)
+	planFile := fs.String("plan", "", "plan of the maas-configure-networking unit, from terraform show -json")
+	fabricsFile := fs.String("fabrics", "", "output of maas <profile> fabrics read")
+	subnetsFile := fs.String("subnets", "", "output of maas <profile> subnets read")
+	spacesFile := fs.String("spaces", "", "output of maas <profile> spaces read (optional)")
+	rangesFile := fs.String("ipranges", "", "output of maas <profile> ipranges read (optional)")
+	module := fs.String("module", "module.maas_configure_networking", "address of the module in the unit")
+	out := fs.String("o", "", "write the import blocks to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *planFile == "" || *fabricsFile == "" || *subnetsFile == "" {
+		return errors.New("-plan, -fabrics and -subnets are required")
+	}
+
+	f, err := os.Open(*planFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cfg, err := adopt.ReadPlan(f)
+	if err != nil {
+		return err
+	}
+
+	var inv adopt.Inventory
+	for _, in := range []struct {
+		file string
+		v    any
+	}{{*fabricsFile, &inv.Fabrics}, {*subnetsFile, &inv.Subnets}, {*spacesFile, &inv.Spaces}, {*rangesFile, &inv.IPRanges}} {
+		if in.file == "" {
+			continue
+		}
+		if err := readJSON(in.file, in.v); err != nil {
+			return err
+		}
+	}
+
+	imports, warnings := adopt.Match(cfg, inv)
+	for _, w := range warnings {
+		log.Print(w)
+	}
+	log.Printf("%d object(s) to import", len(imports))
+
+	if *out == "" {
+		return adopt.Write(stdout, *module, imports)
+	}
+	w, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := adopt.Write(w, *module, imports); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func readJSON(file string, v any) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decoding %s: %w", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+// Command maas-network-topology renders the networking declared for the
+// maas-configure-networking unit (fabric, VLAN, subnet, ranges and space),
+// and optionally where the interfaces of the network profiles of the
+// maas-configure-nodes unit attach to it, as Graphviz DOT, Mermaid or a
+// Markdown table for reviewing networking changes.
+//
+// It reads the variables from the units' tfvars, or from .json files holding
+// tfvars in JSON or a plan from `terraform show -json`:
+//
+//	maas-network-topology -networking networking.tfvars \
+//	  -profiles ../maas-configure-nodes/network_profiles.tfvars -format mermaid
+//
+// Mermaid and Markdown output can be pasted into a pull request as is; DOT
+// output can be drawn with e.g. `dot -Tsvg`.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/hemanthnakkina/sunbeam-maas/tools/internal/topology"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("maas-network-topology: ")
+
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("maas-network-topology", flag.ContinueOnError)
+	networkingFile := fs.String("networking", "", "tfvars of the maas-configure-networking unit, or a .json plan or tfvars in JSON")
+	profilesFile := fs.String("profiles", "", "tfvars of the maas-configure-nodes unit, or a .json plan or tfvars in JSON (optional)")
+	format := fs.String("format", topology.Markdown, "output format: dot, mermaid or markdown")
+	out := fs.String("o", "", "write the topology to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *networkingFile == "" {
+		return errors.New("-networking is required")
+	}
+	f, err := topology.ParseFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	var cfg topology.Config
+	for _, file := range []string{*networkingFile, *profilesFile} {
+		if file == "" {
+			continue
+		}
+		if err := readConfig(file, &cfg); err != nil {
+			return err
+		}
+	}
+	t := topology.Build(cfg)
+
+	if *out == "" {
+		return topology.Write(stdout, f, t)
+	}
+	w, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := topology.Write(w, f, t); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// readConfig reads .json files as a plan or tfvars in JSON and anything else
+// as tfvars.
+func readConfig(file string, cfg *topology.Config) error {
+	if filepath.Ext(file) != ".json" {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		return topology.ReadTfvars(file, src, cfg)
+	}
+
+	r, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := topology.Read(r, cfg); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
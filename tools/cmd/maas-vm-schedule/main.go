@@ -0,0 +1,76 @@
+// Command maas-vm-schedule chooses a MAAS VM host for every VM to compose.
+//
+// It runs as a Terraform external data source. The query holds the policy
+// (bin-pack or spread) and the VMs as a JSON encoded list:
+//
+//	{"policy": "bin-pack", "requests": "[{\"key\": \"db-0\", \"hostname\": \"db-0\", \"cores\": 8, \"memory\": 16384, \"disks\": [{\"pool\": \"fast\", \"size_gigabytes\": 100}]}]"}
+//
+// The result maps every VM key to the ID of its VM host. VMs that already
+// exist keep their host. When the VMs do not fit, the command fails with a
+// report of the unplaced VMs and the free capacity of every VM host.
+//
+// The MAAS API URL and key are read from MAAS_API_URL and MAAS_API_KEY,
+// falling back to the TF_VAR_maas_api_url and TF_VAR_maas_api_key inputs
+// Terragrunt exports to Terraform.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/hemanthnakkina/sunbeam-maas/tools/internal/external"
+	"github.com/hemanthnakkina/sunbeam-maas/tools/internal/maas"
+	"github.com/hemanthnakkina/sunbeam-maas/tools/internal/schedule"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("maas-vm-schedule: ")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Stdin, os.Stdout); err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, stdin io.Reader, stdout io.Writer) error {
+	query, err := external.ReadQuery(stdin)
+	if err != nil {
+		return err
+	}
+	policy, err := schedule.ParsePolicy(query["policy"])
+	if err != nil {
+		return err
+	}
+	var requests []schedule.Request
+	if err := json.Unmarshal([]byte(query["requests"]), &requests); err != nil {
+		return fmt.Errorf("decoding requests: %w", err)
+	}
+
+	client, err := maas.NewClientFromEnv()
+	if err != nil {
+		return err
+	}
+	hosts, err := client.VMHosts(ctx)
+	if err != nil {
+		return fmt.Errorf("listing VM hosts: %w", err)
+	}
+	machines, err := client.Machines(ctx)
+	if err != nil {
+		return fmt.Errorf("listing machines: %w", err)
+	}
+
+	placed, err := schedule.Schedule(hosts, machines, requests, policy)
+	if err != nil {
+		return err
+	}
+	return external.WriteResult(stdout, placed)
+}
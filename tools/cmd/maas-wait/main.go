@@ -0,0 +1,115 @@
+// Command maas-wait blocks until MAAS machines reach a target state.
+//
+// It is the readiness gate used at the boundaries between Terragrunt units.
+// Machines are named by hostname or system ID:
+//
+//	maas-wait -state Ready compute-01 compute-02
+//
+// Machines past the target state (e.g. Deployed when waiting for Ready) count
+// as having reached it.
+//
+// With -external it speaks the protocol of the Terraform external data
+// source: the query is read as a JSON object from stdin and the system ID
+// of every machine, keyed by the requested name, is written to stdout.
+//
+//	{"machines": "compute-01,compute-02", "state": "Ready", "timeout": "30m"}
+//
+// The MAAS API URL and key are read from MAAS_API_URL and MAAS_API_KEY,
+// falling back to the TF_VAR_maas_api_url and TF_VAR_maas_api_key inputs
+// Terragrunt exports to Terraform.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/hemanthnakkina/sunbeam-maas/tools/internal/external"
+	"github.com/hemanthnakkina/sunbeam-maas/tools/internal/maas"
+	"github.com/hemanthnakkina/sunbeam-maas/tools/internal/wait"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("maas-wait: ")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("maas-wait", flag.ContinueOnError)
+	state := fs.String("state", wait.Ready, "target state: Ready, Allocated or Deployed")
+	timeout := fs.Duration("timeout", 30*time.Minute, "give up after this long")
+	interval := fs.Duration("interval", 10*time.Second, "initial poll interval")
+	maxInterval := fs.Duration("max-interval", time.Minute, "maximum poll interval")
+	dataSource := fs.Bool("external", false, "read the query from stdin as a Terraform external data source")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	machines := fs.Args()
+
+	if *dataSource {
+		query, err := external.ReadQuery(stdin)
+		if err != nil {
+			return err
+		}
+		machines = splitList(query["machines"])
+		for key, d := range map[string]*time.Duration{"timeout": timeout, "interval": interval, "max_interval": maxInterval} {
+			if query[key] == "" {
+				continue
+			}
+			if *d, err = time.ParseDuration(query[key]); err != nil {
+				return fmt.Errorf("query %s: %w", key, err)
+			}
+		}
+		if query["state"] != "" {
+			*state = query["state"]
+		}
+	}
+
+	target, err := wait.ParseState(*state)
+	if err != nil {
+		return err
+	}
+	if *timeout <= 0 || *interval <= 0 || *maxInterval < *interval {
+		return errors.New("timeout and interval must be positive and max-interval must not be less than interval")
+	}
+
+	client, err := maas.NewClientFromEnv()
+	if err != nil {
+		return err
+	}
+
+	ids, err := wait.ForMachines(ctx, client, machines, wait.Options{
+		State:       target,
+		Timeout:     *timeout,
+		Interval:    *interval,
+		MaxInterval: *maxInterval,
+		Logf:        log.Printf,
+	})
+	if err != nil {
+		return err
+	}
+	if *dataSource {
+		return external.WriteResult(stdout, ids)
+	}
+	return nil
+}
+
+// splitList splits a comma or whitespace separated list, dropping blanks.
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' })
+}
@@ -0,0 +1,283 @@
+// Package adopt matches the networking declared for the
+// maas-configure-networking module to spaces, fabrics, VLANs, subnets and IP
+// ranges that already exist in MAAS, e.g. fabrics and subnets MAAS discovered
+// when rack controllers registered, so they can be imported instead of
+// created again.
+package adopt
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strconv"
+
+	"github.com/hemanthnakkina/sunbeam-maas/tools/internal/maas"
+)
+
+// Range is a reserved or dynamic IP range declared for a subnet.
+type Range struct {
+	StartIP string `json:"start_ip"`
+	EndIP   string `json:"end_ip"`
+}
+
+// Subnet is a subnet declared for a VLAN.
+type Subnet struct {
+	CIDR     string           `json:"cidr"`
+	Reserved map[string]Range `json:"reserved"`
+}
+
+// VLAN is a VLAN declared for a fabric. VID is nil for VLANs keyed by vid.
+type VLAN struct {
+	VID     *int              `json:"vid"`
+	Subnets map[string]Subnet `json:"subnets"`
+}
+
+// Fabric is a fabric declared for the module.
+type Fabric struct {
+	VLANs map[string]VLAN `json:"vlans"`
+}
+
+// Config is the networking declared for the module: its spaces and fabrics
+// variables. Only the space names are needed.
+type Config struct {
+	Spaces  map[string]json.RawMessage `json:"spaces"`
+	Fabrics map[string]Fabric          `json:"fabrics"`
+}
+
+// ReadPlan reads the Config from a plan of the maas-configure-networking
+// unit, in the JSON form printed by `terraform show -json`.
+func ReadPlan(r io.Reader) (Config, error) {
+	var plan struct {
+		Variables map[string]struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"variables"`
+	}
+	if err := json.NewDecoder(r).Decode(&plan); err != nil {
+		return Config{}, fmt.Errorf("reading plan: %w", err)
+	}
+	fabrics, ok := plan.Variables["fabrics"]
+	if !ok {
+		return Config{}, fmt.Errorf("plan has no fabrics variable; is it a plan of the maas-configure-networking unit?")
+	}
+	var cfg Config
+	if err := json.Unmarshal(fabrics.Value, &cfg.Fabrics); err != nil {
+		return Config{}, fmt.Errorf("decoding fabrics: %w", err)
+	}
+	if spaces, ok := plan.Variables["spaces"]; ok {
+		if err := json.Unmarshal(spaces.Value, &cfg.Spaces); err != nil {
+			return Config{}, fmt.Errorf("decoding spaces: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// Inventory is the networking that exists in MAAS, as read by `maas <profile>
+// spaces read`, `fabrics read`, `subnets read` and `ipranges read`.
+type Inventory struct {
+	Spaces   []maas.Space
+	Fabrics  []maas.Fabric
+	Subnets  []maas.Subnet
+	IPRanges []maas.IPRange
+}
+
+// Import is an existing MAAS object to import, at the address of its
+// resource inside the module.
+type Import struct {
+	Address string
+	ID      string
+}
+
+// Match pairs the declared networking with the inventory:
+//
+//   - spaces by name;
+//   - subnets by CIDR, and IP ranges by their subnet's CIDR and start and
+//     end addresses;
+//   - fabrics by name, or else by the one MAAS fabric holding all their
+//     matched subnets;
+//   - VLANs by vid within their matched fabric.
+//
+// Anything unmatched is left for the module to create. The warnings describe
+// what applying the imports will change, or why an object is not adopted.
+func Match(cfg Config, inv Inventory) (imports []Import, warnings []string) {
+	warnf := func(format string, args ...any) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}
+	add := func(id int, format string, args ...any) {
+		imports = append(imports, Import{Address: fmt.Sprintf(format, args...), ID: strconv.Itoa(id)})
+	}
+
+	for _, name := range sortedKeys(cfg.Spaces) {
+		for _, space := range inv.Spaces {
+			if space.Name == name {
+				add(space.ID, "maas_space.space[%q]", name)
+			}
+		}
+	}
+
+	subnetsByCIDR := map[netip.Prefix]maas.Subnet{}
+	for _, subnet := range inv.Subnets {
+		if p, err := netip.ParsePrefix(subnet.CIDR); err == nil {
+			subnetsByCIDR[p.Masked()] = subnet
+		}
+	}
+	fabricsByID := map[int]maas.Fabric{}
+	for _, fabric := range inv.Fabrics {
+		fabricsByID[fabric.ID] = fabric
+	}
+
+	claimed := map[int]string{}
+	for _, fabricName := range sortedKeys(cfg.Fabrics) {
+		declared := cfg.Fabrics[fabricName]
+		fabric, ok := matchFabric(fabricName, declared, inv.Fabrics, fabricsByID, subnetsByCIDR, warnf)
+		if ok && claimed[fabric.ID] != "" {
+			warnf("fabric %s: MAAS fabric %s (%d) is already adopted by fabric %s; not adopting it", fabricName, fabric.Name, fabric.ID, claimed[fabric.ID])
+			ok = false
+		}
+		if ok {
+			claimed[fabric.ID] = fabricName
+			add(fabric.ID, "maas_fabric.fabric[%q]", fabricName)
+			if fabric.Name != fabricName {
+				warnf("fabric %s: adopting MAAS fabric %s (%d), which applying renames", fabricName, fabric.Name, fabric.ID)
+			}
+		}
+
+		for _, vlanKey := range sortedKeys(declared.VLANs) {
+			vlan := declared.VLANs[vlanKey]
+			key := fabricName + "-" + vlanKey
+			vid, err := strconv.Atoi(vlanKey)
+			if vlan.VID != nil {
+				key, vid, err = fmt.Sprintf("%s-%d", fabricName, *vlan.VID), *vlan.VID, nil
+			}
+			if err != nil {
+				warnf("VLAN %s: keyed by name without a vid; not adopting it", key)
+				continue
+			}
+			if ok {
+				for _, existing := range fabric.VLANs {
+					if existing.VID == vid {
+						imports = append(imports, Import{Address: fmt.Sprintf("maas_vlan.vlan[%q]", key), ID: fmt.Sprintf("%d:%d", fabric.ID, vid)})
+					}
+				}
+			}
+
+			for _, subnetName := range sortedKeys(vlan.Subnets) {
+				subnetKey := key + "-" + subnetName
+				p, err := netip.ParsePrefix(vlan.Subnets[subnetName].CIDR)
+				if err != nil {
+					warnf("subnet %s: %v; not adopting it", subnetName, err)
+					continue
+				}
+				existing, found := subnetsByCIDR[p.Masked()]
+				if !found {
+					continue
+				}
+				add(existing.ID, "maas_subnet.subnet[%q]", subnetKey)
+				if !ok || existing.VLAN.FabricID != fabric.ID || existing.VLAN.VID != vid {
+					warnf("subnet %s: MAAS subnet %s is on VLAN %d of fabric %s; applying moves it to VLAN %d of fabric %s", subnetName, existing.CIDR, existing.VLAN.VID, existing.VLAN.Fabric, vid, fabricName)
+				}
+				matchRanges(subnetKey, p.Masked(), vlan.Subnets[subnetName].Reserved, inv.IPRanges, add, warnf)
+			}
+		}
+	}
+	return imports, warnings
+}
+
+// matchFabric finds the MAAS fabric for a declared fabric: the one with its
+// name, or else the one holding all of its subnets that exist in MAAS.
+func matchFabric(name string, declared Fabric, fabrics []maas.Fabric, byID map[int]maas.Fabric, subnets map[netip.Prefix]maas.Subnet, warnf func(string, ...any)) (maas.Fabric, bool) {
+	for _, fabric := range fabrics {
+		if fabric.Name == name {
+			return fabric, true
+		}
+	}
+
+	ids := map[int]bool{}
+	for _, vlan := range declared.VLANs {
+		for _, subnet := range vlan.Subnets {
+			if p, err := netip.ParsePrefix(subnet.CIDR); err == nil {
+				if existing, ok := subnets[p.Masked()]; ok {
+					ids[existing.VLAN.FabricID] = true
+				}
+			}
+		}
+	}
+	switch len(ids) {
+	case 0:
+		return maas.Fabric{}, false
+	case 1:
+		for id := range ids {
+			fabric, ok := byID[id]
+			if !ok {
+				warnf("fabric %s: its subnets are on MAAS fabric %d, which is missing from the fabrics JSON; not adopting it", name, id)
+			}
+			return fabric, ok
+		}
+	}
+	found := make([]int, 0, len(ids))
+	for id := range ids {
+		found = append(found, id)
+	}
+	sort.Ints(found)
+	warnf("fabric %s: its subnets are spread over MAAS fabrics %v; not adopting the fabric or its VLANs", name, found)
+	return maas.Fabric{}, false
+}
+
+// matchRanges imports the declared ranges of a subnet that exist in MAAS
+// with the same start and end addresses.
+func matchRanges(subnetKey string, subnet netip.Prefix, declared map[string]Range, ranges []maas.IPRange, add func(int, string, ...any), warnf func(string, ...any)) {
+	for _, rangeName := range sortedKeys(declared) {
+		start, err1 := netip.ParseAddr(declared[rangeName].StartIP)
+		end, err2 := netip.ParseAddr(declared[rangeName].EndIP)
+		if err1 != nil || err2 != nil {
+			warnf("range %s-%s: invalid start_ip or end_ip; not adopting it", subnetKey, rangeName)
+			continue
+		}
+		for _, existing := range ranges {
+			p, err := netip.ParsePrefix(existing.Subnet.CIDR)
+			if err != nil || p.Masked() != subnet {
+				continue
+			}
+			existingStart, err1 := netip.ParseAddr(existing.StartIP)
+			existingEnd, err2 := netip.ParseAddr(existing.EndIP)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			switch {
+			case existingStart == start && existingEnd == end:
+				add(existing.ID, "maas_subnet_ip_range.ip_range[%q]", subnetKey+"-"+rangeName)
+			case existingStart.Compare(end) <= 0 && start.Compare(existingEnd) <= 0:
+				warnf("range %s-%s: overlaps MAAS %s range %s-%s, so creating it fails until that range is removed", subnetKey, rangeName, existing.Type, existing.StartIP, existing.EndIP)
+			}
+		}
+	}
+}
+
+// Write writes the imports as Terraform import blocks (Terraform 1.5 or
+// later) for the resources of the module at the given address, e.g.
+// module.maas_configure_networking.
+func Write(w io.Writer, module string, imports []Import) error {
+	if _, err := fmt.Fprintln(w, "# Generated by maas-import-networking: existing MAAS networking adopted by maas-configure-networking"); err != nil {
+		return err
+	}
+	prefix := ""
+	if module != "" {
+		prefix = module + "."
+	}
+	for _, imp := range imports {
+		if _, err := fmt.Fprintf(w, "\nimport {\n  to = %s%s\n  id = %q\n}\n", prefix, imp.Address, imp.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
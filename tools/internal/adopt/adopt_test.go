@@ -0,0 +1,150 @@
+package adopt
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hemanthnakkina/sunbeam-maas/tools/internal/maas"
+)
+
+const plan = `{
+  "format_version": "1.2",
+  "variables": {
+    "spaces": {"value": {"oam-space": {"description": null}}},
+    "fabrics": {"value": {
+      "management-fabric": {"vlans": {
+        "oam": {"vid": 3400, "subnets": {
+          "oam": {"cidr": "10.0.2.0/24", "reserved": {
+            "dhcp": {"start_ip": "10.0.2.200", "end_ip": "10.0.2.254", "type": "dynamic"},
+            "infra": {"start_ip": "10.0.2.10", "end_ip": "10.0.2.15", "type": null}
+          }},
+          "oam-v6": {"cidr": "fd00:0:0:2::/64", "reserved": null}
+        }},
+        "3402": {"vid": null, "subnets": {"admin": {"cidr": "10.0.3.0/24", "reserved": null}}}
+      }}
+    }}
+  }
+}`
+
+// discovered is the networking MAAS discovers when a rack controller
+// registers: an auto-named fabric with the OAM subnets on their VLAN.
+func discovered() Inventory {
+	oam := maas.VLAN{ID: 5001, VID: 3400, FabricID: 1, Fabric: "fabric-1"}
+	return Inventory{
+		Spaces:  []maas.Space{{ID: 4, Name: "oam-space"}, {ID: 5, Name: "undefined"}},
+		Fabrics: []maas.Fabric{{ID: 1, Name: "fabric-1", VLANs: []maas.VLAN{{ID: 5000, VID: 0, FabricID: 1}, oam}}},
+		Subnets: []maas.Subnet{
+			{ID: 7, CIDR: "10.0.2.0/24", VLAN: oam},
+			{ID: 8, CIDR: "fd00:0:0:2::/64", VLAN: oam},
+			{ID: 9, CIDR: "192.168.100.0/24", VLAN: maas.VLAN{ID: 5000, FabricID: 1, Fabric: "fabric-1"}},
+		},
+		IPRanges: []maas.IPRange{
+			{ID: 11, Type: "dynamic", StartIP: "10.0.2.200", EndIP: "10.0.2.254", Subnet: maas.Subnet{CIDR: "10.0.2.0/24"}},
+			{ID: 12, Type: "reserved", StartIP: "10.0.2.12", EndIP: "10.0.2.20", Subnet: maas.Subnet{CIDR: "10.0.2.0/24"}},
+		},
+	}
+}
+
+func readPlan(t *testing.T) Config {
+	t.Helper()
+	cfg, err := ReadPlan(strings.NewReader(plan))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func importIDs(imports []Import) map[string]string {
+	ids := map[string]string{}
+	for _, imp := range imports {
+		ids[imp.Address] = imp.ID
+	}
+	return ids
+}
+
+func TestMatchAdoptsDiscoveredNetworking(t *testing.T) {
+	imports, warnings := Match(readPlan(t), discovered())
+
+	want := map[string]string{
+		`maas_space.space["oam-space"]`:                                    "4",
+		`maas_fabric.fabric["management-fabric"]`:                          "1",
+		`maas_vlan.vlan["management-fabric-3400"]`:                         "1:3400",
+		`maas_subnet.subnet["management-fabric-3400-oam"]`:                 "7",
+		`maas_subnet.subnet["management-fabric-3400-oam-v6"]`:              "8",
+		`maas_subnet_ip_range.ip_range["management-fabric-3400-oam-dhcp"]`: "11",
+	}
+	got := importIDs(imports)
+	if len(got) != len(want) {
+		t.Errorf("got %d imports, want %d: %v", len(got), len(want), got)
+	}
+	for address, id := range want {
+		if got[address] != id {
+			t.Errorf("import %s = %q, want %q", address, got[address], id)
+		}
+	}
+
+	report := strings.Join(warnings, "\n")
+	for _, want := range []string{
+		"adopting MAAS fabric fabric-1 (1), which applying renames",
+		"range management-fabric-3400-oam-infra: overlaps MAAS reserved range 10.0.2.12-10.0.2.20",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("warnings %q do not contain %q", report, want)
+		}
+	}
+}
+
+func TestMatchFabricByName(t *testing.T) {
+	inv := discovered()
+	inv.Fabrics = append(inv.Fabrics, maas.Fabric{ID: 2, Name: "management-fabric", VLANs: []maas.VLAN{{VID: 3402, FabricID: 2}}})
+
+	imports, warnings := Match(readPlan(t), inv)
+	got := importIDs(imports)
+	if got[`maas_fabric.fabric["management-fabric"]`] != "2" || got[`maas_vlan.vlan["management-fabric-3402"]`] != "2:3402" {
+		t.Errorf("expected the fabric named management-fabric and its VLAN 3402, got %v", got)
+	}
+	if _, ok := got[`maas_vlan.vlan["management-fabric-3400"]`]; ok {
+		t.Error("VLAN 3400 is not on the fabric named management-fabric and should be created")
+	}
+	if !strings.Contains(strings.Join(warnings, "\n"), "subnet oam: MAAS subnet 10.0.2.0/24 is on VLAN 3400 of fabric fabric-1; applying moves it to VLAN 3400 of fabric management-fabric") {
+		t.Errorf("expected a warning about the subnet moving fabric, got %v", warnings)
+	}
+}
+
+func TestMatchSkipsFabricsSpreadOverSeveralMAASFabrics(t *testing.T) {
+	inv := discovered()
+	admin := maas.VLAN{VID: 3402, FabricID: 3, Fabric: "fabric-3"}
+	inv.Fabrics = append(inv.Fabrics, maas.Fabric{ID: 3, Name: "fabric-3", VLANs: []maas.VLAN{admin}})
+	inv.Subnets = append(inv.Subnets, maas.Subnet{ID: 10, CIDR: "10.0.3.0/24", VLAN: admin})
+
+	imports, warnings := Match(readPlan(t), inv)
+	got := importIDs(imports)
+	if _, ok := got[`maas_fabric.fabric["management-fabric"]`]; ok {
+		t.Errorf("the fabric should not be adopted, got %v", got)
+	}
+	if got[`maas_subnet.subnet["management-fabric-3402-admin"]`] != "10" {
+		t.Errorf("subnets should still be adopted by CIDR, got %v", got)
+	}
+	if !strings.Contains(strings.Join(warnings, "\n"), "spread over MAAS fabrics [1 3]") {
+		t.Errorf("expected a warning about the spread subnets, got %v", warnings)
+	}
+}
+
+func TestReadPlanRequiresFabrics(t *testing.T) {
+	if _, err := ReadPlan(strings.NewReader(`{"variables": {}}`)); err == nil {
+		t.Fatal("expected an error for a plan without fabrics")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	err := Write(&buf, "module.maas_configure_networking", []Import{{Address: `maas_fabric.fabric["management-fabric"]`, ID: "1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "\nimport {\n  to = module.maas_configure_networking.maas_fabric.fabric[\"management-fabric\"]\n  id = \"1\"\n}\n"
+	if !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("got %q, want suffix %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,24 @@
+// Package external implements the protocol of the Terraform external data
+// source: a JSON object of strings on stdin, a JSON object of strings on
+// stdout, and diagnostics on stderr.
+package external
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// ReadQuery decodes the query the data source writes to stdin.
+func ReadQuery(r io.Reader) (map[string]string, error) {
+	query := map[string]string{}
+	if err := json.NewDecoder(r).Decode(&query); err != nil {
+		return nil, fmt.Errorf("reading query: %w", err)
+	}
+	return query, nil
+}
+
+// WriteResult encodes the result the data source reads from stdout.
+func WriteResult(w io.Writer, result map[string]string) error {
+	return json.NewEncoder(w).Encode(result)
+}
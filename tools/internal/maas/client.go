@@ -0,0 +1,258 @@
+// Package maas is a minimal client for the MAAS 2.0 REST API, covering only
+// what the tools in this repository need.
+package maas
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Machine is the subset of a MAAS machine used by the tools.
+type Machine struct {
+	SystemID      string `json:"system_id"`
+	Hostname      string `json:"hostname"`
+	FQDN          string `json:"fqdn"`
+	StatusName    string `json:"status_name"`
+	StatusMessage string `json:"status_message"`
+	// Pod is the VM host a composed machine runs on, nil for other machines.
+	Pod *Ref `json:"pod"`
+}
+
+// Ref is a reference to another MAAS object.
+type Ref struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Resources is an amount of VM host resources. Memory is in MiB and local
+// storage in bytes.
+type Resources struct {
+	Cores        int   `json:"cores"`
+	Memory       int   `json:"memory"`
+	LocalStorage int64 `json:"local_storage"`
+}
+
+// StoragePool is a VM host storage pool. Sizes are in bytes.
+type StoragePool struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Total     int64  `json:"total"`
+	Used      int64  `json:"used"`
+	Available int64  `json:"available"`
+	Default   bool   `json:"default"`
+}
+
+// VMHost is the subset of a MAAS VM host (pod) used by the tools.
+type VMHost struct {
+	ID                    int           `json:"id"`
+	Name                  string        `json:"name"`
+	Type                  string        `json:"type"`
+	Zone                  Ref           `json:"zone"`
+	Pool                  Ref           `json:"pool"`
+	Total                 Resources     `json:"total"`
+	Used                  Resources     `json:"used"`
+	CPUOverCommitRatio    float64       `json:"cpu_over_commit_ratio"`
+	MemoryOverCommitRatio float64       `json:"memory_over_commit_ratio"`
+	StoragePools          []StoragePool `json:"storage_pools"`
+}
+
+// BlockDevice is the subset of a machine block device used by the tools.
+// Size is in bytes.
+type BlockDevice struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	IDPath string `json:"id_path"`
+	Model  string `json:"model"`
+	Serial string `json:"serial"`
+	Size   int64  `json:"size"`
+}
+
+// ScriptResult is a single commissioning or testing script result.
+type ScriptResult struct {
+	Name       string `json:"name"`
+	StatusName string `json:"status_name"`
+	ExitStatus *int   `json:"exit_status"`
+}
+
+// Space is the subset of a MAAS space used by the tools.
+type Space struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// VLAN is the subset of a MAAS VLAN used by the tools.
+type VLAN struct {
+	ID       int    `json:"id"`
+	VID      int    `json:"vid"`
+	Name     string `json:"name"`
+	FabricID int    `json:"fabric_id"`
+	Fabric   string `json:"fabric"`
+}
+
+// Fabric is the subset of a MAAS fabric used by the tools.
+type Fabric struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	VLANs []VLAN `json:"vlans"`
+}
+
+// Subnet is the subset of a MAAS subnet used by the tools.
+type Subnet struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	CIDR string `json:"cidr"`
+	VLAN VLAN   `json:"vlan"`
+}
+
+// IPRange is the subset of a MAAS IP range used by the tools.
+type IPRange struct {
+	ID      int    `json:"id"`
+	Type    string `json:"type"`
+	StartIP string `json:"start_ip"`
+	EndIP   string `json:"end_ip"`
+	Subnet  Subnet `json:"subnet"`
+}
+
+// Client talks to a MAAS region controller.
+type Client struct {
+	baseURL     string
+	consumerKey string
+	tokenKey    string
+	tokenSecret string
+	http        *http.Client
+}
+
+// NewClient returns a client for the MAAS at apiURL (e.g.
+// http://10.0.0.2:5240/MAAS) authenticating with an API key in the
+// consumer:token:secret form printed by `maas apikey`.
+func NewClient(apiURL, apiKey string) (*Client, error) {
+	if apiURL == "" {
+		return nil, fmt.Errorf("MAAS API URL is empty")
+	}
+	parts := strings.Split(apiKey, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("MAAS API key must have the form consumer:token:secret")
+	}
+	return &Client{
+		baseURL:     strings.TrimSuffix(apiURL, "/") + "/api/2.0",
+		consumerKey: parts[0],
+		tokenKey:    parts[1],
+		tokenSecret: parts[2],
+		http:        &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// NewClientFromEnv returns a client for the MAAS configured in MAAS_API_URL
+// and MAAS_API_KEY, falling back to the TF_VAR_maas_api_url and
+// TF_VAR_maas_api_key inputs Terragrunt exports to Terraform.
+func NewClientFromEnv() (*Client, error) {
+	return NewClient(env("MAAS_API_URL", "TF_VAR_maas_api_url"), env("MAAS_API_KEY", "TF_VAR_maas_api_key"))
+}
+
+// env returns the first non-empty environment variable.
+func env(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// Machines lists every machine known to MAAS.
+func (c *Client) Machines(ctx context.Context) ([]Machine, error) {
+	var machines []Machine
+	if err := c.get(ctx, "/machines/", nil, &machines); err != nil {
+		return nil, err
+	}
+	return machines, nil
+}
+
+// VMHosts lists every VM host known to MAAS.
+func (c *Client) VMHosts(ctx context.Context) ([]VMHost, error) {
+	var hosts []VMHost
+	if err := c.get(ctx, "/pods/", nil, &hosts); err != nil {
+		return nil, err
+	}
+	return hosts, nil
+}
+
+// BlockDevices lists the block devices of a machine.
+func (c *Client) BlockDevices(ctx context.Context, systemID string) ([]BlockDevice, error) {
+	var devices []BlockDevice
+	if err := c.get(ctx, "/nodes/"+url.PathEscape(systemID)+"/blockdevices/", nil, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// ScriptResults returns the results of the latest script run of the given
+// type ("commissioning" or "testing") on a machine.
+func (c *Client) ScriptResults(ctx context.Context, systemID, resultType string) ([]ScriptResult, error) {
+	var sets []struct {
+		Results []ScriptResult `json:"results"`
+	}
+	query := url.Values{"type": {resultType}}
+	if err := c.get(ctx, "/nodes/"+url.PathEscape(systemID)+"/results/", query, &sets); err != nil {
+		return nil, err
+	}
+	var results []ScriptResult
+	for _, set := range sets {
+		results = append(results, set.Results...)
+	}
+	return results, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, out any) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", c.authorization())
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s: %s", path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("GET %s: decoding response: %w", path, err)
+	}
+	return nil
+}
+
+// authorization builds the OAuth 1.0 PLAINTEXT header MAAS expects.
+func (c *Client) authorization() string {
+	params := []string{
+		`oauth_version="1.0"`,
+		`oauth_signature_method="PLAINTEXT"`,
+		fmt.Sprintf(`oauth_consumer_key=%q`, c.consumerKey),
+		fmt.Sprintf(`oauth_token=%q`, c.tokenKey),
+		fmt.Sprintf(`oauth_signature="&%s"`, url.QueryEscape(c.tokenSecret)),
+		fmt.Sprintf(`oauth_nonce=%q`, strconv.FormatInt(time.Now().UnixNano(), 36)),
+		fmt.Sprintf(`oauth_timestamp="%d"`, time.Now().Unix()),
+	}
+	return "OAuth " + strings.Join(params, ", ")
+}
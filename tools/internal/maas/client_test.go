@@ -0,0 +1,108 @@
+package maas
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewClientRejectsMalformedKey(t *testing.T) {
+	if _, err := NewClient("http://maas:5240/MAAS", "not-a-key"); err == nil {
+		t.Fatal("expected an error for a key without consumer:token:secret parts")
+	}
+}
+
+func TestMachinesSendsPlaintextOAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/MAAS/api/2.0/machines/" {
+			http.NotFound(w, r)
+			return
+		}
+		auth := r.Header.Get("Authorization")
+		for _, want := range []string{`oauth_consumer_key="ck"`, `oauth_token="tk"`, `oauth_signature="&secret"`, `oauth_signature_method="PLAINTEXT"`} {
+			if !strings.Contains(auth, want) {
+				t.Errorf("Authorization header %q missing %s", auth, want)
+			}
+		}
+		w.Write([]byte(`[{"system_id":"abc123","hostname":"compute-01","fqdn":"compute-01.maas","status_name":"Ready"}]`))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL+"/MAAS/", "ck:tk:secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	machines, err := c.Machines(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(machines) != 1 || machines[0].SystemID != "abc123" || machines[0].StatusName != "Ready" {
+		t.Fatalf("unexpected machines: %+v", machines)
+	}
+}
+
+func TestScriptResultsFlattensResultSets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/MAAS/api/2.0/nodes/abc123/results/" || r.URL.Query().Get("type") != "testing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[{"results":[{"name":"smartctl-validate","status_name":"Passed","exit_status":0}]},
+			{"results":[{"name":"60-nvme-wear-check","status_name":"Failed","exit_status":1}]}]`))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL+"/MAAS", "ck:tk:secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := c.ScriptResults(context.Background(), "abc123", "testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[1].Name != "60-nvme-wear-check" || *results[1].ExitStatus != 1 {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+}
+
+func TestErrorStatusIsReported(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Authorization Error", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL+"/MAAS", "ck:tk:secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Machines(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected a 401 error, got %v", err)
+	}
+}
+
+func TestBlockDevicesReadsMachineDevices(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/MAAS/api/2.0/nodes/abc123/blockdevices/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[{"id":12,"name":"sdb","type":"physical","id_path":"/dev/disk/by-id/scsi-0QEMU_QEMU_HARDDISK_lxd_disk1","size":107374182400},
+			{"id":11,"name":"sda","type":"physical","model":"QEMU HARDDISK","serial":"lxd_root","size":21474836480}]`))
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL+"/MAAS", "ck:tk:secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	devices, err := c.BlockDevices(context.Background(), "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 2 || devices[0].IDPath == "" || devices[1].Serial != "lxd_root" || devices[1].Size != 21474836480 {
+		t.Fatalf("unexpected block devices: %+v", devices)
+	}
+}
@@ -0,0 +1,274 @@
+// Package schedule chooses MAAS VM hosts for VMs to be composed, based on the
+// free cores, memory and storage pool space of each host.
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hemanthnakkina/sunbeam-maas/tools/internal/maas"
+)
+
+// Policies for choosing among the VM hosts a VM fits on.
+const (
+	// BinPack fills the fullest host that still fits, keeping hosts free
+	// for large VMs.
+	BinPack = "bin-pack"
+	// Spread uses the emptiest host, spreading load across hosts.
+	Spread = "spread"
+)
+
+// ParsePolicy validates a scheduling policy name.
+func ParsePolicy(s string) (string, error) {
+	switch s {
+	case BinPack, Spread:
+		return s, nil
+	}
+	return "", fmt.Errorf("unsupported policy %q: must be %s or %s", s, BinPack, Spread)
+}
+
+// Disk is a disk requested for a VM. An empty Pool selects the host's
+// default storage pool.
+type Disk struct {
+	Pool   string `json:"pool"`
+	SizeGB int64  `json:"size_gigabytes"`
+}
+
+// Request is a VM to place. Memory is in MiB.
+type Request struct {
+	Key      string `json:"key"`
+	Hostname string `json:"hostname"`
+	Cores    int    `json:"cores"`
+	Memory   int    `json:"memory"`
+	Disks    []Disk `json:"disks"`
+	// Host pins the VM to a VM host (ID or name); it is only accounted for.
+	Host string `json:"host"`
+	// Candidates restricts the VM hosts (IDs or names) the VM may be placed
+	// on. Empty means any host.
+	Candidates []string `json:"candidates"`
+}
+
+func (r Request) String() string {
+	s := fmt.Sprintf("%s: %d cores, %d MiB memory", r.Key, r.Cores, r.Memory)
+	sizes := r.storage()
+	pools := make([]string, 0, len(sizes))
+	for pool := range sizes {
+		pools = append(pools, pool)
+	}
+	sort.Strings(pools)
+	for _, pool := range pools {
+		name := pool
+		if name == "" {
+			name = "default pool"
+		}
+		s += fmt.Sprintf(", %s %d GB", name, sizes[pool]/gigabyte)
+	}
+	return s
+}
+
+const gigabyte = 1000 * 1000 * 1000
+
+// storage sums the requested disk sizes per pool, in bytes.
+func (r Request) storage() map[string]int64 {
+	sizes := map[string]int64{}
+	for _, d := range r.Disks {
+		sizes[d.Pool] += d.SizeGB * gigabyte
+	}
+	return sizes
+}
+
+// host tracks the free capacity of a VM host while VMs are placed on it.
+type host struct {
+	id, name, zone string
+	cores, memory  int
+	pools          map[string]int64
+	defaultPool    string
+}
+
+func newHost(h maas.VMHost) *host {
+	ratio := func(r float64) float64 {
+		if r <= 0 {
+			return 1
+		}
+		return r
+	}
+	free := &host{
+		id:     strconv.Itoa(h.ID),
+		name:   h.Name,
+		zone:   h.Zone.Name,
+		cores:  int(float64(h.Total.Cores)*ratio(h.CPUOverCommitRatio)) - h.Used.Cores,
+		memory: int(float64(h.Total.Memory)*ratio(h.MemoryOverCommitRatio)) - h.Used.Memory,
+		pools:  map[string]int64{},
+	}
+	for _, p := range h.StoragePools {
+		free.pools[p.Name] = p.Available
+		if p.Default {
+			free.defaultPool = p.Name
+		}
+	}
+	return free
+}
+
+func (h *host) pool(name string) string {
+	if name == "" {
+		return h.defaultPool
+	}
+	return name
+}
+
+func (h *host) fits(r Request) bool {
+	if r.Cores > h.cores || r.Memory > h.memory {
+		return false
+	}
+	for pool, size := range r.storage() {
+		free, ok := h.pools[h.pool(pool)]
+		if !ok || size > free {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *host) take(r Request) {
+	h.cores -= r.Cores
+	h.memory -= r.Memory
+	for pool, size := range r.storage() {
+		h.pools[h.pool(pool)] -= size
+	}
+}
+
+func (h *host) String() string {
+	s := fmt.Sprintf("%s (id %s", h.name, h.id)
+	if h.zone != "" {
+		s += ", zone " + h.zone
+	}
+	s += fmt.Sprintf("): %d cores, %d MiB memory", h.cores, h.memory)
+	names := make([]string, 0, len(h.pools))
+	for name := range h.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s += fmt.Sprintf(", %s %d GB", name, h.pools[name]/gigabyte)
+	}
+	return s
+}
+
+// CapacityError reports the VMs that could not be placed and the capacity
+// left on every VM host.
+type CapacityError struct {
+	Policy   string
+	Unplaced []Request
+	hosts    []*host
+}
+
+func (e *CapacityError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "cannot place %d VM(s) with the %s policy:", len(e.Unplaced), e.Policy)
+	for _, r := range e.Unplaced {
+		b.WriteString("\n  " + r.String())
+	}
+	b.WriteString("\nfree VM host capacity after placing the other VMs:")
+	for _, h := range e.hosts {
+		b.WriteString("\n  " + h.String())
+	}
+	return b.String()
+}
+
+// Schedule returns the ID of the VM host for every request, keyed by
+// request key. VMs that already exist (matched by hostname among machines)
+// keep their VM host, since their resources are already in use there.
+// Requests with a fixed Host only consume capacity. The remaining requests
+// are placed largest first according to policy; if any does not fit, a
+// *CapacityError is returned.
+func Schedule(vmHosts []maas.VMHost, machines []maas.Machine, requests []Request, policy string) (map[string]string, error) {
+	hosts := make([]*host, 0, len(vmHosts))
+	byRef := map[string]*host{}
+	for _, vh := range vmHosts {
+		h := newHost(vh)
+		hosts = append(hosts, h)
+		byRef[h.id] = h
+		byRef[h.name] = h
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].name < hosts[j].name })
+
+	composed := map[string]string{}
+	for _, m := range machines {
+		if m.Pod != nil {
+			composed[m.Hostname] = strconv.Itoa(m.Pod.ID)
+		}
+	}
+
+	placed := make(map[string]string, len(requests))
+	var pending []Request
+	for _, r := range requests {
+		for _, ref := range append([]string{r.Host}, r.Candidates...) {
+			if _, ok := byRef[ref]; ref != "" && !ok {
+				return nil, fmt.Errorf("%s: unknown VM host %q", r.Key, ref)
+			}
+		}
+		switch {
+		case composed[r.Hostname] != "":
+			placed[r.Key] = composed[r.Hostname]
+		case r.Host != "":
+			h := byRef[r.Host]
+			h.take(r)
+			placed[r.Key] = h.id
+		default:
+			pending = append(pending, r)
+		}
+	}
+
+	// Largest first places big VMs while there is still room for them
+	sort.SliceStable(pending, func(i, j int) bool {
+		if pending[i].Memory != pending[j].Memory {
+			return pending[i].Memory > pending[j].Memory
+		}
+		return pending[i].Cores > pending[j].Cores
+	})
+
+	var unplaced []Request
+	for _, r := range pending {
+		candidates := hosts
+		if len(r.Candidates) > 0 {
+			candidates = nil
+			for _, ref := range r.Candidates {
+				candidates = append(candidates, byRef[ref])
+			}
+		}
+		var best *host
+		for _, h := range candidates {
+			if !h.fits(r) {
+				continue
+			}
+			if best == nil || better(h, best, policy) {
+				best = h
+			}
+		}
+		if best == nil {
+			unplaced = append(unplaced, r)
+			continue
+		}
+		best.take(r)
+		placed[r.Key] = best.id
+	}
+
+	if len(unplaced) > 0 {
+		return nil, &CapacityError{Policy: policy, Unplaced: unplaced, hosts: hosts}
+	}
+	return placed, nil
+}
+
+// better reports whether a is preferred over b under policy, comparing free
+// memory, then free cores, then name for a stable result.
+func better(a, b *host, policy string) bool {
+	if a.memory != b.memory {
+		return (a.memory < b.memory) == (policy == BinPack)
+	}
+	if a.cores != b.cores {
+		return (a.cores < b.cores) == (policy == BinPack)
+	}
+	return a.name < b.name
+}
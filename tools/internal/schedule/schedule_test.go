@@ -0,0 +1,103 @@
+package schedule
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hemanthnakkina/sunbeam-maas/tools/internal/maas"
+)
+
+func vmHost(id int, name string, cores, memory int, poolGB int64) maas.VMHost {
+	return maas.VMHost{
+		ID:    id,
+		Name:  name,
+		Zone:  maas.Ref{Name: "az1"},
+		Total: maas.Resources{Cores: cores, Memory: memory},
+		StoragePools: []maas.StoragePool{
+			{Name: "default", Available: poolGB * gigabyte, Default: true},
+		},
+	}
+}
+
+func vm(key string, cores, memory int, diskGB int64) Request {
+	return Request{Key: key, Hostname: key, Cores: cores, Memory: memory, Disks: []Disk{{SizeGB: diskGB}}}
+}
+
+func TestScheduleBinPackFillsFullestHost(t *testing.T) {
+	hosts := []maas.VMHost{vmHost(1, "big", 32, 65536, 1000), vmHost(2, "small", 8, 16384, 500)}
+	placed, err := Schedule(hosts, nil, []Request{vm("a", 2, 4096, 20), vm("b", 2, 4096, 20)}, BinPack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if placed["a"] != "2" || placed["b"] != "2" {
+		t.Fatalf("expected both VMs on the smaller host, got %v", placed)
+	}
+}
+
+func TestScheduleSpreadUsesEmptiestHost(t *testing.T) {
+	hosts := []maas.VMHost{vmHost(1, "a", 16, 32768, 1000), vmHost(2, "b", 16, 32768, 1000)}
+	placed, err := Schedule(hosts, nil, []Request{vm("x", 4, 8192, 20), vm("y", 4, 8192, 20)}, Spread)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if placed["x"] == placed["y"] {
+		t.Fatalf("expected VMs on different hosts, got %v", placed)
+	}
+}
+
+func TestScheduleHonoursOverCommitAndExistingVMs(t *testing.T) {
+	h := vmHost(1, "a", 4, 8192, 1000)
+	h.CPUOverCommitRatio = 2
+	h.Used = maas.Resources{Cores: 4, Memory: 4096}
+	machines := []maas.Machine{{Hostname: "old", Pod: &maas.Ref{ID: 7}}}
+
+	placed, err := Schedule([]maas.VMHost{h}, machines, []Request{vm("old", 4, 4096, 20), vm("new", 4, 4096, 20)}, BinPack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if placed["old"] != "7" || placed["new"] != "1" {
+		t.Fatalf("unexpected placement %v", placed)
+	}
+}
+
+func TestScheduleRespectsCandidatesAndStoragePools(t *testing.T) {
+	hosts := []maas.VMHost{vmHost(1, "a", 16, 32768, 50), vmHost(2, "b", 16, 32768, 1000)}
+	r := vm("db", 4, 8192, 100)
+	r.Candidates = []string{"a"}
+
+	_, err := Schedule(hosts, nil, []Request{r}, BinPack)
+	var capErr *CapacityError
+	if !errors.As(err, &capErr) {
+		t.Fatalf("expected *CapacityError, got %v", err)
+	}
+	msg := err.Error()
+	for _, want := range []string{"cannot place 1 VM(s) with the bin-pack policy", "db: 4 cores, 8192 MiB memory, default pool 100 GB", "a (id 1, zone az1): 16 cores, 32768 MiB memory, default 50 GB"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q does not contain %q", msg, want)
+		}
+	}
+}
+
+func TestScheduleFixedHostsConsumeCapacity(t *testing.T) {
+	hosts := []maas.VMHost{vmHost(1, "a", 8, 16384, 1000), vmHost(2, "b", 8, 16384, 1000)}
+	fixed := vm("pinned", 8, 16384, 20)
+	fixed.Host = "a"
+
+	placed, err := Schedule(hosts, nil, []Request{fixed, vm("free", 2, 2048, 20)}, BinPack)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if placed["pinned"] != "1" || placed["free"] != "2" {
+		t.Fatalf("unexpected placement %v", placed)
+	}
+}
+
+func TestScheduleRejectsUnknownHosts(t *testing.T) {
+	r := vm("x", 1, 1024, 10)
+	r.Candidates = []string{"missing"}
+	_, err := Schedule([]maas.VMHost{vmHost(1, "a", 8, 16384, 1000)}, nil, []Request{r}, Spread)
+	if err == nil || !strings.Contains(err.Error(), `unknown VM host "missing"`) {
+		t.Fatalf("expected an unknown VM host error, got %v", err)
+	}
+}
@@ -0,0 +1,335 @@
+package topology
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Formats a Topology can be written in.
+const (
+	DOT      = "dot"
+	Mermaid  = "mermaid"
+	Markdown = "markdown"
+)
+
+// ParseFormat validates an output format name.
+func ParseFormat(s string) (string, error) {
+	switch s {
+	case DOT, Mermaid, Markdown:
+		return s, nil
+	}
+	return "", fmt.Errorf("unsupported format %q: must be %s, %s or %s", s, DOT, Mermaid, Markdown)
+}
+
+// Write writes the topology in the given format.
+func Write(w io.Writer, format string, t Topology) error {
+	switch format {
+	case DOT:
+		return writeDOT(w, newGraph(t))
+	case Mermaid:
+		return writeMermaid(w, newGraph(t))
+	case Markdown:
+		return writeMarkdown(w, t)
+	}
+	return fmt.Errorf("unsupported format %q", format)
+}
+
+// Node shapes of the graph.
+const (
+	shapeBox     = "box"
+	shapeRange   = "range"
+	shapeSpace   = "space"
+	shapeMissing = "missing"
+)
+
+type graphNode struct {
+	id    string
+	lines []string
+	shape string
+}
+
+type graphEdge struct {
+	from, to string
+	label    string
+	dashed   bool
+}
+
+type cluster struct {
+	id    string
+	label string
+	nodes []graphNode
+}
+
+// graph is the topology as nodes and edges, shared by the DOT and Mermaid
+// writers: a cluster per fabric holding its VLANs, subnets and ranges, the
+// spaces, and a cluster per network profile holding its linked interfaces.
+type graph struct {
+	clusters []cluster
+	nodes    []graphNode
+	edges    []graphEdge
+}
+
+func newGraph(t Topology) graph {
+	var g graph
+
+	spaceIDs := map[string]string{}
+	for i, space := range t.Spaces {
+		spaceIDs[space] = fmt.Sprintf("space%d", i)
+		g.nodes = append(g.nodes, graphNode{id: spaceIDs[space], lines: []string{"space " + space}, shape: shapeSpace})
+	}
+
+	// VLANs are referenced by relays as <fabric>-<vid> or <fabric>-<VLAN key>,
+	// and subnets by profile links by name
+	vlanIDs := map[string]string{}
+	subnetIDs := map[string]string{}
+	type relay struct{ from, to string }
+	var relays []relay
+	for i, fabric := range t.Fabrics {
+		c := cluster{id: fmt.Sprintf("fabric%d", i), label: "fabric " + fabric.Name}
+		for j, vlan := range fabric.VLANs {
+			vlanID := fmt.Sprintf("vlan%d_%d", i, j)
+			vlanIDs[fmt.Sprintf("%s-%d", fabric.Name, vlan.VID)] = vlanID
+			vlanIDs[fabric.Name+"-"+vlan.Name] = vlanID
+
+			lines := []string{"VLAN " + vlan.Name, fmt.Sprintf("vid %d, mtu %d", vlan.VID, vlan.MTU)}
+			if vlan.DHCP {
+				lines = append(lines, "DHCP")
+			}
+			c.nodes = append(c.nodes, graphNode{id: vlanID, lines: lines, shape: shapeBox})
+			if vlan.Space != "" {
+				g.edges = append(g.edges, graphEdge{from: vlanID, to: spaceIDs[vlan.Space], dashed: true})
+			}
+			if vlan.Relay != "" {
+				relays = append(relays, relay{from: vlanID, to: vlan.Relay})
+			}
+
+			for k, subnet := range vlan.Subnets {
+				subnetID := fmt.Sprintf("subnet%d_%d_%d", i, j, k)
+				subnetIDs[subnet.Name] = subnetID
+				lines := []string{subnet.Name, subnet.CIDR}
+				if subnet.Mode != "" {
+					lines[1] += " (" + subnet.Mode + ")"
+				}
+				if subnet.Gateway != "" {
+					lines = append(lines, "gw "+subnet.Gateway)
+				}
+				c.nodes = append(c.nodes, graphNode{id: subnetID, lines: lines, shape: shapeBox})
+				g.edges = append(g.edges, graphEdge{from: vlanID, to: subnetID})
+
+				for l, r := range subnet.Ranges {
+					rangeID := fmt.Sprintf("range%d_%d_%d_%d", i, j, k, l)
+					c.nodes = append(c.nodes, graphNode{
+						id:    rangeID,
+						lines: []string{fmt.Sprintf("%s (%s)", r.Name, r.Type), r.StartIP + " - " + r.EndIP},
+						shape: shapeRange,
+					})
+					g.edges = append(g.edges, graphEdge{from: subnetID, to: rangeID})
+				}
+			}
+		}
+		g.clusters = append(g.clusters, c)
+	}
+	for _, r := range relays {
+		if to, ok := vlanIDs[r.to]; ok {
+			g.edges = append(g.edges, graphEdge{from: r.from, to: to, label: "DHCP relay", dashed: true})
+		}
+	}
+
+	missingIDs := map[string]string{}
+	profileIndex := map[string]int{}
+	interfaceIDs := map[string]string{}
+	for _, a := range t.Attachments {
+		i, ok := profileIndex[a.Profile]
+		if !ok {
+			i = len(g.clusters)
+			profileIndex[a.Profile] = i
+			g.clusters = append(g.clusters, cluster{id: fmt.Sprintf("profile%d", i), label: "profile " + a.Profile})
+		}
+		c := &g.clusters[i]
+
+		ifaceID, ok := interfaceIDs[a.Profile+"/"+a.Interface]
+		if !ok {
+			ifaceID = fmt.Sprintf("iface%d_%d", i, len(c.nodes))
+			interfaceIDs[a.Profile+"/"+a.Interface] = ifaceID
+			label := a.Interface
+			if a.Kind != "" {
+				label += " (" + a.Kind + ")"
+			}
+			c.nodes = append(c.nodes, graphNode{id: ifaceID, lines: []string{label}, shape: shapeBox})
+		}
+
+		subnetID, ok := subnetIDs[a.Subnet]
+		if !ok {
+			subnetID, ok = missingIDs[a.Subnet]
+			if !ok {
+				subnetID = fmt.Sprintf("missing%d", len(missingIDs))
+				missingIDs[a.Subnet] = subnetID
+				g.nodes = append(g.nodes, graphNode{id: subnetID, lines: []string{a.Subnet, "not declared"}, shape: shapeMissing})
+			}
+		}
+		label := a.Mode
+		if a.DefaultGateway {
+			label += ", default gw"
+		}
+		g.edges = append(g.edges, graphEdge{from: ifaceID, to: subnetID, label: label})
+	}
+	return g
+}
+
+func writeDOT(w io.Writer, g graph) error {
+	var b strings.Builder
+	b.WriteString("digraph topology {\n  rankdir=LR;\n  node [shape=box];\n")
+	node := func(indent string, n graphNode) {
+		attrs := ""
+		switch n.shape {
+		case shapeRange:
+			attrs = ", shape=note"
+		case shapeSpace:
+			attrs = ", shape=ellipse"
+		case shapeMissing:
+			attrs = ", style=dashed"
+		}
+		fmt.Fprintf(&b, "%s%s [label=%s%s];\n", indent, n.id, dotQuote(strings.Join(n.lines, "\n")), attrs)
+	}
+	for _, c := range g.clusters {
+		fmt.Fprintf(&b, "  subgraph cluster_%s {\n    label=%s;\n", c.id, dotQuote(c.label))
+		for _, n := range c.nodes {
+			node("    ", n)
+		}
+		b.WriteString("  }\n")
+	}
+	for _, n := range g.nodes {
+		node("  ", n)
+	}
+	for _, e := range g.edges {
+		var attrs []string
+		if e.label != "" {
+			attrs = append(attrs, "label="+dotQuote(e.label))
+		}
+		if e.dashed {
+			attrs = append(attrs, "style=dashed")
+		}
+		fmt.Fprintf(&b, "  %s -> %s", e.from, e.to)
+		if len(attrs) > 0 {
+			fmt.Fprintf(&b, " [%s]", strings.Join(attrs, ", "))
+		}
+		b.WriteString(";\n")
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + strings.ReplaceAll(s, "\n", `\n`) + `"`
+}
+
+func writeMermaid(w io.Writer, g graph) error {
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	node := func(indent string, n graphNode) {
+		label := mermaidQuote(strings.Join(n.lines, "\n"))
+		switch n.shape {
+		case shapeRange:
+			fmt.Fprintf(&b, "%s%s[/%s/]\n", indent, n.id, label)
+		case shapeSpace:
+			fmt.Fprintf(&b, "%s%s([%s])\n", indent, n.id, label)
+		case shapeMissing:
+			fmt.Fprintf(&b, "%s%s{{%s}}\n", indent, n.id, label)
+		default:
+			fmt.Fprintf(&b, "%s%s[%s]\n", indent, n.id, label)
+		}
+	}
+	for _, c := range g.clusters {
+		fmt.Fprintf(&b, "  subgraph %s[%s]\n", c.id, mermaidQuote(c.label))
+		for _, n := range c.nodes {
+			node("    ", n)
+		}
+		b.WriteString("  end\n")
+	}
+	for _, n := range g.nodes {
+		node("  ", n)
+	}
+	for _, e := range g.edges {
+		arrow := "-->"
+		if e.dashed {
+			arrow = "-.->"
+		}
+		if e.label != "" {
+			fmt.Fprintf(&b, "  %s %s|%s| %s\n", e.from, arrow, mermaidQuote(e.label), e.to)
+		} else {
+			fmt.Fprintf(&b, "  %s %s %s\n", e.from, arrow, e.to)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func mermaidQuote(s string) string {
+	s = strings.ReplaceAll(s, `"`, "#quot;")
+	return `"` + strings.ReplaceAll(s, "\n", "<br/>") + `"`
+}
+
+func writeMarkdown(w io.Writer, t Topology) error {
+	var b strings.Builder
+	b.WriteString("## Networks\n\n")
+	b.WriteString("| Fabric | VLAN | VID | MTU | DHCP | Subnet | CIDR | Gateway | Ranges | Space |\n")
+	b.WriteString("|--------|------|-----|-----|------|--------|------|---------|--------|-------|\n")
+	for _, fabric := range t.Fabrics {
+		for _, vlan := range fabric.VLANs {
+			dhcp := ""
+			switch {
+			case vlan.Relay != "":
+				dhcp = "relay to " + vlan.Relay
+			case vlan.DHCP:
+				dhcp = "yes"
+			}
+			row := []string{fabric.Name, vlan.Name, strconv.Itoa(vlan.VID), strconv.Itoa(vlan.MTU), dhcp}
+			if len(vlan.Subnets) == 0 {
+				markdownRow(&b, append(row, "", "", "", "", vlan.Space))
+				continue
+			}
+			for _, subnet := range vlan.Subnets {
+				cidr := subnet.CIDR
+				if subnet.Mode != "" {
+					cidr += " (" + subnet.Mode + ")"
+				}
+				var ranges []string
+				for _, r := range subnet.Ranges {
+					ranges = append(ranges, fmt.Sprintf("%s (%s): %s - %s", r.Name, r.Type, r.StartIP, r.EndIP))
+				}
+				markdownRow(&b, append(row, subnet.Name, cidr, subnet.Gateway, strings.Join(ranges, "<br>"), vlan.Space))
+			}
+		}
+	}
+
+	if len(t.Attachments) > 0 {
+		b.WriteString("\n## Profile Interfaces\n\n")
+		b.WriteString("| Profile | Interface | Type | Subnet | Mode | Default Gateway |\n")
+		b.WriteString("|---------|-----------|------|--------|------|-----------------|\n")
+		for _, a := range t.Attachments {
+			subnet := a.Subnet
+			if !a.Known {
+				subnet += " (not declared)"
+			}
+			gateway := ""
+			if a.DefaultGateway {
+				gateway = "yes"
+			}
+			markdownRow(&b, []string{a.Profile, a.Interface, a.Kind, subnet, a.Mode, gateway})
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func markdownRow(b *strings.Builder, cells []string) {
+	for i, cell := range cells {
+		cells[i] = strings.ReplaceAll(cell, "|", `\|`)
+	}
+	fmt.Fprintf(b, "| %s |\n", strings.Join(cells, " | "))
+}
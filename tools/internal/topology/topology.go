@@ -0,0 +1,350 @@
+// Package topology renders the networking declared for the
+// maas-configure-networking module, and where the interfaces of node network
+// profiles attach to it, as Graphviz DOT, Mermaid or Markdown, so changes to
+// the networking can be reviewed as a picture or a table rather than as
+// nested tfvars.
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strconv"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Range is a reserved or dynamic IP range declared for a subnet.
+type Range struct {
+	StartIP string  `json:"start_ip"`
+	EndIP   string  `json:"end_ip"`
+	Type    *string `json:"type"`
+}
+
+// Subnet is a subnet declared for a VLAN.
+type Subnet struct {
+	CIDR      string           `json:"cidr"`
+	GatewayIP *string          `json:"gateway_ip"`
+	IPv6Mode  *string          `json:"ipv6_mode"`
+	Reserved  map[string]Range `json:"reserved"`
+}
+
+// VLAN is a VLAN declared for a fabric. VID is nil for VLANs keyed by vid.
+type VLAN struct {
+	VID       *int              `json:"vid"`
+	Space     *string           `json:"space"`
+	DHCPOn    *bool             `json:"dhcp_on"`
+	MTU       *int              `json:"mtu"`
+	RelayVLAN *string           `json:"relay_vlan"`
+	Subnets   map[string]Subnet `json:"subnets"`
+}
+
+// Fabric is a fabric declared for the module.
+type Fabric struct {
+	VLANs map[string]VLAN `json:"vlans"`
+}
+
+// Interface is an interface of a network profile. Only what is needed to
+// name it and place it under its parents is kept.
+type Interface struct {
+	Name    *string  `json:"name"`
+	Parent  *string  `json:"parent"`
+	Parents []string `json:"parents"`
+	VLANID  *int     `json:"vlan_id"`
+}
+
+// Link attaches an interface of a network profile to a subnet.
+type Link struct {
+	NetworkInterface string `json:"network_interface"`
+	SubnetID         string `json:"subnet_id"`
+	Mode             string `json:"mode"`
+	DefaultGateway   bool   `json:"default_gateway"`
+}
+
+// Profile is a network profile of the maas-configure-nodes-networking module.
+type Profile struct {
+	PhysicalInterfaces map[string]Interface `json:"physical_interfaces"`
+	BondInterfaces     map[string]Interface `json:"bond_interfaces"`
+	BridgeInterfaces   map[string]Interface `json:"bridge_interfaces"`
+	VLANInterfaces     map[string]Interface `json:"vlan_interfaces"`
+	InterfaceLinks     map[string]Link      `json:"interface_links"`
+}
+
+// Config is the declared networking: the spaces and fabrics variables of the
+// networking module and the network_profiles variable of the nodes module.
+// Only the space names are needed.
+type Config struct {
+	Spaces          map[string]json.RawMessage `json:"spaces"`
+	Fabrics         map[string]Fabric          `json:"fabrics"`
+	NetworkProfiles map[string]Profile         `json:"network_profiles"`
+}
+
+// variableNames are the variables a Config is read from.
+var variableNames = []string{"spaces", "fabrics", "network_profiles"}
+
+// ReadTfvars adds the spaces, fabrics and network_profiles of a tfvars file,
+// e.g. networking.tfvars or network_profiles.tfvars, to cfg. Other variables
+// in the file are ignored.
+func ReadTfvars(filename string, src []byte, cfg *Config) error {
+	file, diags := hclparse.NewParser().ParseHCL(src, filename)
+	if diags.HasErrors() {
+		return diags
+	}
+	attrs, diags := file.Body.JustAttributes()
+	if diags.HasErrors() {
+		return diags
+	}
+
+	vars := map[string]json.RawMessage{}
+	for _, name := range variableNames {
+		attr, ok := attrs[name]
+		if !ok {
+			continue
+		}
+		value, diags := attr.Expr.Value(&hcl.EvalContext{})
+		if diags.HasErrors() {
+			return diags
+		}
+		raw, err := ctyjson.Marshal(value, value.Type())
+		if err != nil {
+			return fmt.Errorf("%s: converting %s: %w", filename, name, err)
+		}
+		vars[name] = raw
+	}
+	if err := decode(vars, cfg); err != nil {
+		return fmt.Errorf("%s: %w", filename, err)
+	}
+	return nil
+}
+
+// Read adds the spaces, fabrics and network_profiles found in r to cfg. r
+// holds either a plan in the JSON form printed by `terraform show -json` or
+// tfvars in JSON (.tfvars.json), so the networking and the profiles can be
+// read from their own units.
+func Read(r io.Reader, cfg *Config) error {
+	var vars map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&vars); err != nil {
+		return fmt.Errorf("reading variables: %w", err)
+	}
+	if raw, ok := vars["variables"]; ok {
+		var plan map[string]struct {
+			Value json.RawMessage `json:"value"`
+		}
+		if err := json.Unmarshal(raw, &plan); err != nil {
+			return fmt.Errorf("decoding plan variables: %w", err)
+		}
+		vars = make(map[string]json.RawMessage, len(plan))
+		for name, v := range plan {
+			vars[name] = v.Value
+		}
+	}
+
+	return decode(vars, cfg)
+}
+
+// decode adds the variables, as JSON, to cfg.
+func decode(vars map[string]json.RawMessage, cfg *Config) error {
+	found := false
+	for _, v := range []struct {
+		name string
+		dst  any
+	}{{"spaces", &cfg.Spaces}, {"fabrics", &cfg.Fabrics}, {"network_profiles", &cfg.NetworkProfiles}} {
+		raw, ok := vars[v.name]
+		if !ok {
+			continue
+		}
+		found = true
+		if err := json.Unmarshal(raw, v.dst); err != nil {
+			return fmt.Errorf("decoding %s: %w", v.name, err)
+		}
+	}
+	if !found {
+		return fmt.Errorf("no spaces, fabrics or network_profiles variables found")
+	}
+	return nil
+}
+
+// Topology is the declared networking, sorted for rendering.
+type Topology struct {
+	Fabrics []FabricNode
+	// Spaces are the declared spaces, plus any referenced by a VLAN
+	// without being declared.
+	Spaces      []string
+	Attachments []Attachment
+}
+
+// FabricNode is a fabric and its VLANs, by vid.
+type FabricNode struct {
+	Name  string
+	VLANs []VLANNode
+}
+
+// VLANNode is a VLAN and its subnets, by name. Name is the VLAN's name in
+// MAAS and Relay the name of the VLAN it relays DHCP to.
+type VLANNode struct {
+	Name    string
+	VID     int
+	MTU     int
+	DHCP    bool
+	Space   string
+	Relay   string
+	Subnets []SubnetNode
+}
+
+// SubnetNode is a subnet and its ranges, by start address. Mode is the IPv6
+// address assignment mode (empty for IPv4 subnets).
+type SubnetNode struct {
+	Name    string
+	CIDR    string
+	Gateway string
+	Mode    string
+	Ranges  []RangeNode
+}
+
+// RangeNode is an IP range of a subnet.
+type RangeNode struct {
+	Name    string
+	Type    string
+	StartIP string
+	EndIP   string
+}
+
+// Attachment is an interface of a network profile linked to a subnet. Known
+// is false when the link's subnet_id is not a declared subnet name, e.g. a
+// MAAS subnet ID.
+type Attachment struct {
+	Profile        string
+	Interface      string
+	Kind           string
+	Subnet         string
+	Mode           string
+	DefaultGateway bool
+	Known          bool
+}
+
+// Build sorts the declared networking into a Topology, naming VLANs and
+// defaulting MTU, DHCP, range types and IPv6 modes the way the modules do.
+func Build(cfg Config) Topology {
+	var t Topology
+	spaces := map[string]bool{}
+	for name := range cfg.Spaces {
+		spaces[name] = true
+	}
+	subnets := map[string]bool{}
+
+	for _, fabricName := range sortedKeys(cfg.Fabrics) {
+		fabric := FabricNode{Name: fabricName}
+		for vlanKey, vlan := range cfg.Fabrics[fabricName].VLANs {
+			node := VLANNode{Name: vlanKey, MTU: 1500}
+			if vid, err := strconv.Atoi(vlanKey); err == nil {
+				node.Name = fmt.Sprintf("%s-%s", fabricName, vlanKey)
+				node.VID = vid
+			}
+			if vlan.VID != nil {
+				node.VID = *vlan.VID
+			}
+			if vlan.MTU != nil {
+				node.MTU = *vlan.MTU
+			}
+			node.DHCP = vlan.DHCPOn != nil && *vlan.DHCPOn
+			if vlan.Space != nil {
+				node.Space = *vlan.Space
+				spaces[node.Space] = true
+			}
+			if vlan.RelayVLAN != nil {
+				node.Relay = *vlan.RelayVLAN
+			}
+			for _, subnetName := range sortedKeys(vlan.Subnets) {
+				node.Subnets = append(node.Subnets, buildSubnet(subnetName, vlan.Subnets[subnetName]))
+				subnets[subnetName] = true
+			}
+			fabric.VLANs = append(fabric.VLANs, node)
+		}
+		sort.Slice(fabric.VLANs, func(i, j int) bool { return fabric.VLANs[i].VID < fabric.VLANs[j].VID })
+		t.Fabrics = append(t.Fabrics, fabric)
+	}
+	t.Spaces = sortedKeys(spaces)
+
+	for _, profileName := range sortedKeys(cfg.NetworkProfiles) {
+		profile := cfg.NetworkProfiles[profileName]
+		kinds := map[string]string{}
+		for _, set := range []struct {
+			kind       string
+			interfaces map[string]Interface
+		}{
+			{"physical", profile.PhysicalInterfaces},
+			{"bond", profile.BondInterfaces},
+			{"bridge", profile.BridgeInterfaces},
+			{"vlan", profile.VLANInterfaces},
+		} {
+			for key, iface := range set.interfaces {
+				kinds[key] = set.kind
+				if iface.Name != nil {
+					kinds[*iface.Name] = set.kind
+				}
+			}
+		}
+		for _, linkKey := range sortedKeys(profile.InterfaceLinks) {
+			link := profile.InterfaceLinks[linkKey]
+			t.Attachments = append(t.Attachments, Attachment{
+				Profile:        profileName,
+				Interface:      link.NetworkInterface,
+				Kind:           kinds[link.NetworkInterface],
+				Subnet:         link.SubnetID,
+				Mode:           link.Mode,
+				DefaultGateway: link.DefaultGateway,
+				Known:          subnets[link.SubnetID],
+			})
+		}
+	}
+	return t
+}
+
+func buildSubnet(name string, subnet Subnet) SubnetNode {
+	node := SubnetNode{Name: name, CIDR: subnet.CIDR}
+	if subnet.GatewayIP != nil {
+		node.Gateway = *subnet.GatewayIP
+	}
+	dynamic := false
+	for rangeName, r := range subnet.Reserved {
+		rangeType := "reserved"
+		if r.Type != nil {
+			rangeType = *r.Type
+		}
+		dynamic = dynamic || rangeType == "dynamic"
+		node.Ranges = append(node.Ranges, RangeNode{Name: rangeName, Type: rangeType, StartIP: r.StartIP, EndIP: r.EndIP})
+	}
+	sort.Slice(node.Ranges, func(i, j int) bool {
+		a, errA := netip.ParseAddr(node.Ranges[i].StartIP)
+		b, errB := netip.ParseAddr(node.Ranges[j].StartIP)
+		if errA != nil || errB != nil || a == b {
+			return node.Ranges[i].Name < node.Ranges[j].Name
+		}
+		return a.Less(b)
+	})
+
+	if prefix, err := netip.ParsePrefix(subnet.CIDR); err == nil && prefix.Addr().Is6() {
+		switch {
+		case subnet.IPv6Mode != nil:
+			node.Mode = *subnet.IPv6Mode
+		case dynamic:
+			node.Mode = "dhcpv6"
+		default:
+			node.Mode = "slaac"
+		}
+	}
+	return node
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,229 @@
+package topology
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+const networkingPlan = `{
+  "format_version": "1.2",
+  "variables": {
+    "spaces": {"value": {"oam-space": {"description": null}}},
+    "fabrics": {"value": {
+      "management-fabric": {"vlans": {
+        "oam": {"vid": 3400, "space": "oam-space", "dhcp_on": true, "mtu": null, "relay_vlan": null, "subnets": {
+          "oam": {"cidr": "10.0.2.0/24", "gateway_ip": "10.0.2.1", "ipv6_mode": null, "reserved": {
+            "dhcp": {"start_ip": "10.0.2.200", "end_ip": "10.0.2.254", "type": "dynamic"},
+            "infra": {"start_ip": "10.0.2.10", "end_ip": "10.0.2.15", "type": null}
+          }},
+          "oam-v6": {"cidr": "fd00:0:0:2::/64", "gateway_ip": null, "ipv6_mode": null, "reserved": null}
+        }},
+        "3402": {"vid": null, "space": "admin-space", "dhcp_on": null, "mtu": 9000, "relay_vlan": "management-fabric-oam", "subnets": {
+          "admin": {"cidr": "10.0.3.0/24", "gateway_ip": null, "ipv6_mode": null, "reserved": null}
+        }}
+      }}
+    }}
+  }
+}`
+
+// profilesTfvars are network profiles as .tfvars.json, linking to a declared
+// subnet by name and to another by MAAS ID
+const profilesTfvars = `{
+  "network_profiles": {
+    "compute": {
+      "physical_interfaces": {"eth0": {}},
+      "bond_interfaces": {"bond0": {"name": "bond0", "parents": ["eth1", "eth2"]}},
+      "interface_links": {
+        "eth0-oam": {"network_interface": "eth0", "subnet_id": "oam", "mode": "STATIC", "default_gateway": true},
+        "bond0-storage": {"network_interface": "bond0", "subnet_id": "42", "mode": "DHCP"}
+      }
+    }
+  }
+}`
+
+func build(t *testing.T) Topology {
+	t.Helper()
+	var cfg Config
+	for _, in := range []string{networkingPlan, profilesTfvars} {
+		if err := Read(strings.NewReader(in), &cfg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return Build(cfg)
+}
+
+func TestBuild(t *testing.T) {
+	topo := build(t)
+
+	if len(topo.Fabrics) != 1 || len(topo.Fabrics[0].VLANs) != 2 {
+		t.Fatalf("fabrics = %+v, want one fabric with two VLANs", topo.Fabrics)
+	}
+	oam, admin := topo.Fabrics[0].VLANs[0], topo.Fabrics[0].VLANs[1]
+	if oam.Name != "oam" || oam.VID != 3400 || oam.MTU != 1500 || !oam.DHCP || oam.Space != "oam-space" {
+		t.Errorf("oam VLAN = %+v", oam)
+	}
+	// VLANs keyed by vid are named after their fabric, as in MAAS
+	if admin.Name != "management-fabric-3402" || admin.VID != 3402 || admin.MTU != 9000 || admin.Relay != "management-fabric-oam" {
+		t.Errorf("admin VLAN = %+v", admin)
+	}
+
+	subnet := oam.Subnets[0]
+	if subnet.Name != "oam" || subnet.Gateway != "10.0.2.1" || subnet.Mode != "" {
+		t.Errorf("oam subnet = %+v", subnet)
+	}
+	if len(subnet.Ranges) != 2 || subnet.Ranges[0].Name != "infra" || subnet.Ranges[0].Type != "reserved" || subnet.Ranges[1].Type != "dynamic" {
+		t.Errorf("oam ranges = %+v, want infra (reserved) then dhcp (dynamic)", subnet.Ranges)
+	}
+	if mode := oam.Subnets[1].Mode; mode != "slaac" {
+		t.Errorf("oam-v6 mode = %q, want slaac without a dynamic range", mode)
+	}
+
+	// admin-space is used without being declared
+	if got := strings.Join(topo.Spaces, ","); got != "admin-space,oam-space" {
+		t.Errorf("spaces = %s", got)
+	}
+
+	want := []Attachment{
+		{Profile: "compute", Interface: "bond0", Kind: "bond", Subnet: "42", Mode: "DHCP"},
+		{Profile: "compute", Interface: "eth0", Kind: "physical", Subnet: "oam", Mode: "STATIC", DefaultGateway: true, Known: true},
+	}
+	if len(topo.Attachments) != len(want) {
+		t.Fatalf("attachments = %+v, want %+v", topo.Attachments, want)
+	}
+	for i := range want {
+		if topo.Attachments[i] != want[i] {
+			t.Errorf("attachment %d = %+v, want %+v", i, topo.Attachments[i], want[i])
+		}
+	}
+}
+
+func TestReadRejectsOtherUnits(t *testing.T) {
+	var cfg Config
+	err := Read(strings.NewReader(`{"variables": {"machines": {"value": {}}}}`), &cfg)
+	if err == nil || !strings.Contains(err.Error(), "no spaces, fabrics or network_profiles") {
+		t.Errorf("err = %v, want a missing variables error", err)
+	}
+}
+
+func TestReadTfvarsExamples(t *testing.T) {
+	var cfg Config
+	for _, file := range []string{
+		"../../../clouds/prod/maas-configure-networking/networking.tfvars.example",
+		"../../../clouds/prod/maas-configure-nodes/network_profiles.tfvars.example",
+	} {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ReadTfvars(file, src, &cfg); err != nil {
+			t.Fatalf("ReadTfvars(%s): %v", file, err)
+		}
+	}
+
+	if _, ok := cfg.Spaces["oam-space"]; !ok {
+		t.Errorf("spaces = %v, want oam-space", cfg.Spaces)
+	}
+	oam := cfg.Fabrics["management-fabric"].VLANs["oam"]
+	if oam.VID == nil || *oam.VID != 3400 || oam.Space == nil || *oam.Space != "oam-space" {
+		t.Errorf("management-fabric VLAN oam = %+v, want vid 3400 in oam-space", oam)
+	}
+	subnet := oam.Subnets["oam"]
+	if subnet.CIDR != "10.0.2.0/24" || subnet.Reserved["dhcp"].Type == nil || *subnet.Reserved["dhcp"].Type != "dynamic" {
+		t.Errorf("subnet oam = %+v, want 10.0.2.0/24 with a dynamic dhcp range", subnet)
+	}
+	if got := cfg.NetworkProfiles["hyperconverged"].BondInterfaces["bond0"].Parents; len(got) != 2 {
+		t.Errorf("hyperconverged bond0 parents = %v, want eth1 and eth2", got)
+	}
+
+	topo := Build(cfg)
+	if len(topo.Fabrics) == 0 || len(topo.Attachments) == 0 {
+		t.Errorf("Build() = %d fabrics and %d attachments, want both", len(topo.Fabrics), len(topo.Attachments))
+	}
+}
+
+func TestReadTfvarsErrors(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"syntax", `fabrics = {`, "test.tfvars:1"},
+		{"other unit", `machines = {}`, "test.tfvars: no spaces, fabrics or network_profiles"},
+		{"wrong type", `fabrics = { f = { vlans = "none" } }`, "test.tfvars: decoding fabrics"},
+	}
+	for _, tt := range tests {
+		var cfg Config
+		err := ReadTfvars("test.tfvars", []byte(tt.src), &cfg)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var out bytes.Buffer
+	if err := Write(&out, Markdown, build(t)); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"| management-fabric | oam | 3400 | 1500 | yes | oam | 10.0.2.0/24 | 10.0.2.1 | infra (reserved): 10.0.2.10 - 10.0.2.15<br>dhcp (dynamic): 10.0.2.200 - 10.0.2.254 | oam-space |\n",
+		"| management-fabric | oam | 3400 | 1500 | yes | oam-v6 | fd00:0:0:2::/64 (slaac) |  |  | oam-space |\n",
+		"| management-fabric | management-fabric-3402 | 3402 | 9000 | relay to management-fabric-oam | admin | 10.0.3.0/24 |  |  | admin-space |\n",
+		"| compute | bond0 | bond | 42 (not declared) | DHCP |  |\n",
+		"| compute | eth0 | physical | oam | STATIC | yes |\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("markdown is missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestWriteGraphs(t *testing.T) {
+	topo := build(t)
+	for _, tc := range []struct {
+		format string
+		want   []string
+	}{
+		{DOT, []string{
+			"digraph topology {\n",
+			`subgraph cluster_fabric0 {`,
+			`vlan0_0 [label="VLAN oam\nvid 3400, mtu 1500\nDHCP"];`,
+			`range0_0_0_0 [label="infra (reserved)\n10.0.2.10 - 10.0.2.15", shape=note];`,
+			`vlan0_0 -> space1 [style=dashed];`,
+			`vlan0_1 -> vlan0_0 [label="DHCP relay", style=dashed];`,
+			`missing0 [label="42\nnot declared", style=dashed];`,
+			`iface1_1 -> subnet0_0_0 [label="STATIC, default gw"];`,
+		}},
+		{Mermaid, []string{
+			"flowchart LR\n",
+			`subgraph fabric0["fabric management-fabric"]`,
+			`vlan0_0["VLAN oam<br/>vid 3400, mtu 1500<br/>DHCP"]`,
+			`range0_0_0_0[/"infra (reserved)<br/>10.0.2.10 - 10.0.2.15"/]`,
+			`space1(["space oam-space"])`,
+			`vlan0_1 -.->|"DHCP relay"| vlan0_0`,
+			`missing0{{"42<br/>not declared"}}`,
+			`iface1_1 -->|"STATIC, default gw"| subnet0_0_0`,
+		}},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Write(&out, tc.format, topo); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("%s output is missing %q:\n%s", tc.format, want, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if _, err := ParseFormat("svg"); err == nil {
+		t.Error("ParseFormat(svg) succeeded, want an error")
+	}
+	if f, err := ParseFormat(Mermaid); err != nil || f != Mermaid {
+		t.Errorf("ParseFormat(mermaid) = %q, %v", f, err)
+	}
+}
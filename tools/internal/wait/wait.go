@@ -0,0 +1,230 @@
+// Package wait polls MAAS until a set of machines reaches a target state.
+package wait
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hemanthnakkina/sunbeam-maas/tools/internal/maas"
+)
+
+// States that can be waited for.
+const (
+	Ready     = "Ready"
+	Allocated = "Allocated"
+	Deployed  = "Deployed"
+)
+
+// ParseState returns the canonical name of a target state, accepting any case.
+func ParseState(s string) (string, error) {
+	for _, state := range []string{Ready, Allocated, Deployed} {
+		if strings.EqualFold(s, state) {
+			return state, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported state %q: must be one of Ready, Allocated, Deployed", s)
+}
+
+// API is the part of the MAAS client the poller needs.
+type API interface {
+	Machines(ctx context.Context) ([]maas.Machine, error)
+	ScriptResults(ctx context.Context, systemID, resultType string) ([]maas.ScriptResult, error)
+}
+
+// Options controls how long and how often MAAS is polled. The poll interval
+// starts at Interval and doubles after every poll up to MaxInterval.
+type Options struct {
+	State       string
+	Timeout     time.Duration
+	Interval    time.Duration
+	MaxInterval time.Duration
+	// Logf, when set, receives a progress line after every poll.
+	Logf func(format string, args ...any)
+}
+
+// Status is the last observed state of one requested machine.
+type Status struct {
+	Name          string
+	SystemID      string
+	StatusName    string
+	StatusMessage string
+	// FailedScripts lists the commissioning/testing scripts that did not
+	// pass when the machine ended in a failed state.
+	FailedScripts []string
+}
+
+func (s Status) String() string {
+	if s.SystemID == "" {
+		return s.Name + ": not found in MAAS"
+	}
+	line := fmt.Sprintf("%s (%s): %s", s.Name, s.SystemID, s.StatusName)
+	if s.StatusMessage != "" {
+		line += " - " + s.StatusMessage
+	}
+	for _, script := range s.FailedScripts {
+		line += "\n    " + script
+	}
+	return line
+}
+
+// Error reports every machine that did not reach the target state.
+type Error struct {
+	State    string
+	Reason   string
+	Machines []Status
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d machine(s) did not reach %s (%s):", len(e.Machines), e.State, e.Reason)
+	for _, m := range e.Machines {
+		b.WriteString("\n  ")
+		b.WriteString(m.String())
+	}
+	return b.String()
+}
+
+// lifecycle orders the states a machine passes through after commissioning.
+// A machine further along than the target state has already been through it,
+// e.g. a Deployed machine was Ready, so waiting for Ready is satisfied.
+var lifecycle = map[string]int{Ready: 1, Allocated: 2, "Deploying": 3, Deployed: 4}
+
+// reached reports whether a machine in status has reached target.
+func reached(status, target string) bool {
+	return status == target || lifecycle[status] > 0 && lifecycle[status] >= lifecycle[target]
+}
+
+// failed reports whether MAAS will not move a machine out of its state on
+// its own.
+func failed(status string) bool {
+	return strings.HasPrefix(status, "Failed") || status == "Broken"
+}
+
+// ForMachines polls MAAS until every machine, named by hostname or system
+// ID, is in opts.State or a later state of the lifecycle (Ready, Allocated,
+// Deploying, Deployed), so a gate that runs again on every plan keeps
+// passing once machines move on. It returns the system ID of each machine keyed by
+// the name it was requested with. A machine entering a failed state stops
+// the wait early; the returned *Error then describes every machine that is
+// not in the target state.
+func ForMachines(ctx context.Context, api API, names []string, opts Options) (map[string]string, error) {
+	if len(names) == 0 {
+		return map[string]string{}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	interval := opts.Interval
+	var pending []Status
+	for {
+		statuses, err := poll(ctx, api, names)
+		switch {
+		case errors.Is(err, context.DeadlineExceeded):
+			// Report the last completed poll below.
+		case err != nil:
+			return nil, err
+		default:
+			var broken []Status
+			pending = nil
+			for _, s := range statuses {
+				switch {
+				case reached(s.StatusName, opts.State):
+				case failed(s.StatusName):
+					broken = append(broken, s)
+				default:
+					pending = append(pending, s)
+				}
+			}
+			if opts.Logf != nil {
+				opts.Logf("%d/%d machines %s", len(names)-len(pending)-len(broken), len(names), opts.State)
+			}
+			if len(broken) > 0 {
+				for i := range broken {
+					broken[i].FailedScripts = failedScripts(ctx, api, broken[i])
+				}
+				return nil, &Error{State: opts.State, Reason: "machines failed", Machines: append(broken, pending...)}
+			}
+			if len(pending) == 0 {
+				ids := make(map[string]string, len(statuses))
+				for _, s := range statuses {
+					ids[s.Name] = s.SystemID
+				}
+				return ids, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if pending == nil {
+				return nil, fmt.Errorf("timed out after %s waiting for machines to reach %s", opts.Timeout, opts.State)
+			}
+			return nil, &Error{State: opts.State, Reason: "timed out after " + opts.Timeout.String(), Machines: pending}
+		case <-time.After(interval):
+		}
+		interval *= 2
+		if interval > opts.MaxInterval {
+			interval = opts.MaxInterval
+		}
+	}
+}
+
+// poll returns the current status of every requested machine, sorted by name.
+func poll(ctx context.Context, api API, names []string) ([]Status, error) {
+	machines, err := api.Machines(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing machines: %w", err)
+	}
+	byName := make(map[string]maas.Machine, 2*len(machines))
+	for _, m := range machines {
+		byName[m.SystemID] = m
+		byName[m.Hostname] = m
+		byName[m.FQDN] = m
+	}
+
+	statuses := make([]Status, 0, len(names))
+	for _, name := range names {
+		s := Status{Name: name}
+		if m, ok := byName[name]; ok {
+			s.SystemID = m.SystemID
+			s.StatusName = m.StatusName
+			s.StatusMessage = m.StatusMessage
+		}
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses, nil
+}
+
+// failedScripts describes the scripts that did not pass on a failed machine.
+// Lookup errors are reported inline rather than hiding the machine status.
+func failedScripts(ctx context.Context, api API, s Status) []string {
+	var resultType string
+	switch s.StatusName {
+	case "Failed commissioning":
+		resultType = "commissioning"
+	case "Failed testing":
+		resultType = "testing"
+	default:
+		return nil
+	}
+	results, err := api.ScriptResults(ctx, s.SystemID, resultType)
+	if err != nil {
+		return []string{fmt.Sprintf("could not read %s results: %v", resultType, err)}
+	}
+	var lines []string
+	for _, r := range results {
+		if r.StatusName == "Passed" || r.StatusName == "Skipped" {
+			continue
+		}
+		line := fmt.Sprintf("%s: %s", r.Name, r.StatusName)
+		if r.ExitStatus != nil {
+			line += fmt.Sprintf(" (exit status %d)", *r.ExitStatus)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
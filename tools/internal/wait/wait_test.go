@@ -0,0 +1,139 @@
+package wait
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hemanthnakkina/sunbeam-maas/tools/internal/maas"
+)
+
+// fakeAPI returns one machine listing per poll, repeating the last one.
+type fakeAPI struct {
+	polls   [][]maas.Machine
+	calls   int
+	results map[string][]maas.ScriptResult
+}
+
+func (f *fakeAPI) Machines(ctx context.Context) ([]maas.Machine, error) {
+	i := f.calls
+	if i >= len(f.polls) {
+		i = len(f.polls) - 1
+	}
+	f.calls++
+	return f.polls[i], nil
+}
+
+func (f *fakeAPI) ScriptResults(ctx context.Context, systemID, resultType string) ([]maas.ScriptResult, error) {
+	return f.results[systemID+"/"+resultType], nil
+}
+
+func machine(id, hostname, status string) maas.Machine {
+	return maas.Machine{SystemID: id, Hostname: hostname, FQDN: hostname + ".maas", StatusName: status}
+}
+
+var fast = Options{State: Ready, Timeout: time.Second, Interval: time.Millisecond, MaxInterval: 2 * time.Millisecond}
+
+func TestParseState(t *testing.T) {
+	for in, want := range map[string]string{"ready": Ready, "DEPLOYED": Deployed, "Allocated": Allocated} {
+		got, err := ParseState(in)
+		if err != nil || got != want {
+			t.Errorf("ParseState(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseState("Commissioning"); err == nil {
+		t.Error("expected an error for an unsupported state")
+	}
+}
+
+func TestForMachinesWaitsUntilAllReady(t *testing.T) {
+	api := &fakeAPI{polls: [][]maas.Machine{
+		{machine("a1", "compute-01", "Commissioning"), machine("b2", "compute-02", "Testing")},
+		{machine("a1", "compute-01", "Ready"), machine("b2", "compute-02", "Testing")},
+		{machine("a1", "compute-01", "Ready"), machine("b2", "compute-02", "Ready")},
+	}}
+
+	ids, err := ForMachines(context.Background(), api, []string{"compute-01", "b2"}, fast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids["compute-01"] != "a1" || ids["b2"] != "b2" {
+		t.Fatalf("unexpected ids: %v", ids)
+	}
+	if api.calls != 3 {
+		t.Fatalf("expected 3 polls, got %d", api.calls)
+	}
+}
+
+func TestForMachinesAcceptsLaterStates(t *testing.T) {
+	api := &fakeAPI{polls: [][]maas.Machine{
+		{machine("a1", "compute-01", "Deployed"), machine("b2", "compute-02", "Allocated"), machine("c3", "compute-03", "Ready")},
+	}}
+
+	ids, err := ForMachines(context.Background(), api, []string{"compute-01", "compute-02", "compute-03"}, fast)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 3 || api.calls != 1 {
+		t.Fatalf("expected all machines satisfied on the first poll, got %v after %d polls", ids, api.calls)
+	}
+
+	// Ready is earlier than Deployed, so it does not satisfy a wait for Deployed
+	opts := fast
+	opts.State = Deployed
+	opts.Timeout = 20 * time.Millisecond
+	api = &fakeAPI{polls: [][]maas.Machine{{machine("c3", "compute-03", "Ready")}}}
+	if _, err := ForMachines(context.Background(), api, []string{"compute-03"}, opts); err == nil {
+		t.Fatal("expected a Ready machine to time out waiting for Deployed")
+	}
+}
+
+func TestForMachinesReportsFailedScripts(t *testing.T) {
+	exit := 1
+	api := &fakeAPI{
+		polls: [][]maas.Machine{{machine("a1", "compute-01", "Ready"), machine("c3", "storage-01", "Failed testing")}},
+		results: map[string][]maas.ScriptResult{"c3/testing": {
+			{Name: "smartctl-validate", StatusName: "Passed"},
+			{Name: "60-nvme-wear-check", StatusName: "Failed", ExitStatus: &exit},
+		}},
+	}
+
+	_, err := ForMachines(context.Background(), api, []string{"compute-01", "storage-01"}, fast)
+	var werr *Error
+	if !errors.As(err, &werr) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	if len(werr.Machines) != 1 || werr.Machines[0].Name != "storage-01" {
+		t.Fatalf("unexpected failed machines: %+v", werr.Machines)
+	}
+	msg := err.Error()
+	for _, want := range []string{"storage-01 (c3): Failed testing", "60-nvme-wear-check: Failed (exit status 1)"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q does not contain %q", msg, want)
+		}
+	}
+	if strings.Contains(msg, "smartctl-validate") {
+		t.Errorf("error %q lists a passed script", msg)
+	}
+}
+
+func TestForMachinesTimesOutWithPendingMachines(t *testing.T) {
+	api := &fakeAPI{polls: [][]maas.Machine{{machine("a1", "compute-01", "Deploying")}}}
+	opts := fast
+	opts.State = Deployed
+	opts.Timeout = 20 * time.Millisecond
+
+	_, err := ForMachines(context.Background(), api, []string{"compute-01", "compute-09"}, opts)
+	var werr *Error
+	if !errors.As(err, &werr) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	msg := err.Error()
+	for _, want := range []string{"did not reach Deployed (timed out", "compute-01 (a1): Deploying", "compute-09: not found in MAAS"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q does not contain %q", msg, want)
+		}
+	}
+}